@@ -0,0 +1,137 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Activity Definitions - a feed of the newest marble creates, transfers and deletes, for the UI
+//
+// A ring of MAX_ACTIVITY slots under composite key "activity" [slot]. Each record overwrites the slot picked by hashing
+// its tx id, marble id and kind, without reading it first, so concurrent transactions don't conflict on the feed.
+// The price is that a new record can land on a slot that isn't the oldest, the feed is the recent activity that
+// survived rather than exactly the last MAX_ACTIVITY.
+// ============================================================================================================================
+const MAX_ACTIVITY = 50
+
+type Activity struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	Kind       string `json:"kind"`    //create, transfer, delete or reconcile
+	MarbleId   string `json:"marbleId"`
+	FromOwner  string `json:"fromOwner,omitempty"`
+	ToOwner    string `json:"toOwner,omitempty"`
+	Timestamp  int64  `json:"timestamp"` //ms, tx time
+	TxId       string `json:"txId"`
+}
+
+// ============================================================================================================================
+// Get Recent Activity - the newest activity, newest first
+//
+// Inputs - Array of Strings
+//      0
+//    limit
+//     "10"
+// ============================================================================================================================
+func get_recent_activity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit <= 0 {
+		return shim.Error("1st argument must be a positive numeric string")
+	}
+
+	feed, err := get_activity_feed(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	sort.Slice(feed, func(i, j int) bool {                       //newest first
+		if feed[i].Timestamp != feed[j].Timestamp {
+			return feed[i].Timestamp > feed[j].Timestamp
+		}
+		return feed[i].TxId > feed[j].TxId
+	})
+	activities := []Activity{}
+	for i := 0; i < len(feed) && len(activities) < limit; i++ {
+		activities = append(activities, feed[i])
+	}
+
+	activitiesAsBytes, _ := json.Marshal(activities)             //convert to array of bytes
+	return shim.Success(activitiesAsBytes)
+}
+
+// ============================================================================================================================
+// Activity helpers
+// ============================================================================================================================
+
+// add to the feed, a blind write to one slot of the ring
+func record_activity(stub shim.ChaincodeStubInterface, kind string, marble_id string, from string, to string) error {
+	var activity Activity
+	var err error
+	activity.ObjectType = "activity"
+	activity.Kind = kind
+	activity.MarbleId = marble_id
+	activity.FromOwner = from
+	activity.ToOwner = to
+	activity.TxId = stub.GetTxID()
+	activity.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+
+	activityAsBytes, _ := json.Marshal(activity)                 //convert to array of bytes
+	return stub.PutState(activity_key(stub, activity), activityAsBytes)
+}
+
+func get_activity_feed(stub shim.ChaincodeStubInterface) ([]Activity, error) {
+	var feed []Activity
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("activity", []string{})
+	if err != nil {
+		return feed, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return feed, err
+		}
+		var activity Activity
+		json.Unmarshal(queryResponse.Value, &activity)           //un stringify it aka JSON.parse()
+		feed = append(feed, activity)
+	}
+	return feed, nil
+}
+
+// the slot's key, records from the same tx about different marbles get different slots (bar a hash collision)
+func activity_key(stub shim.ChaincodeStubInterface, activity Activity) string {
+	slotHash := sha256.Sum256([]byte(activity.TxId + "|" + activity.MarbleId + "|" + activity.Kind))
+	slot := binary.BigEndian.Uint64(slotHash[:8]) % MAX_ACTIVITY
+	key, _ := stub.CreateCompositeKey("activity", []string{strconv.FormatUint(slot, 10)})
+	return key
+}
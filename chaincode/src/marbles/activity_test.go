@@ -0,0 +1,59 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestRecordActivityDoesNotScanTheFeed(t *testing.T) {
+	stub, _, alice, _ := new_identity_fixture(t)
+
+	stub.must(t, alice, "init_marble", "m2", "blue", "35", "o1", COMPANY)
+	if contains(stub.scans, "activity") {
+		t.Fatal("creating a marble should not read the activity feed")
+	}
+	stub.must(t, alice, "set_owner", "m2", "o2", COMPANY)
+	if contains(stub.scans, "activity") {
+		t.Fatal("a transfer should not read the activity feed")
+	}
+}
+
+func TestRecentActivityIsNewestFirstAndBounded(t *testing.T) {
+	stub, _, alice, _ := new_identity_fixture(t)
+	for i := 0; i < MAX_ACTIVITY * 2; i++ {
+		stub.now += 1000
+		stub.must(t, alice, "init_marble", "m" + strconv.Itoa(100 + i), "blue", "35", "o1", COMPANY)
+	}
+
+	var activities []Activity
+	json.Unmarshal(stub.must(t, alice, "get_recent_activity", "1000").Payload, &activities)
+	if len(activities) == 0 || len(activities) > MAX_ACTIVITY {
+		t.Fatalf("expected 1 to %d activities, got %d", MAX_ACTIVITY, len(activities))
+	}
+	for i := 1; i < len(activities); i++ {
+		if activities[i].Timestamp > activities[i - 1].Timestamp {
+			t.Fatal("activity should be newest first")
+		}
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Admin Definitions - admins are tracked by invoker id (see get_invoker()), the instantiator becomes the first admin
+// ============================================================================================================================
+const ADMINS_KEY = "_admins"
+const PAUSED_KEY = "_paused"
+const ROLES_KEY = "_roles"
+
+// ============================================================================================================================
+// Get Admins - get the list of admin ids from ledger
+// ============================================================================================================================
+func get_admins(stub shim.ChaincodeStubInterface) ([]string, error) {
+	var admins []string
+	adminsAsBytes, err := stub.GetState(ADMINS_KEY)
+	if err != nil {
+		return admins, errors.New("Failed to get admins")
+	}
+	if adminsAsBytes == nil {                                  //no admins yet
+		return admins, nil
+	}
+	err = json.Unmarshal(adminsAsBytes, &admins)               //un stringify it aka JSON.parse()
+	if err != nil {
+		return admins, errors.New("Failed to parse admins")
+	}
+	return admins, nil
+}
+
+// ============================================================================================================================
+// Init Admins - store the invoker as the first admin, does nothing if admins already exist (init is also used as reset)
+// ============================================================================================================================
+func init_admins(stub shim.ChaincodeStubInterface) error {
+	admins, err := get_admins(stub)
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {                                       //already have admins, leave them be
+		return nil
+	}
+
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	admins = append(admins, invoker)
+	adminsAsBytes, _ := json.Marshal(admins)                   //convert to array of bytes
+	return stub.PutState(ADMINS_KEY, adminsAsBytes)
+}
+
+// ============================================================================================================================
+// Check Admin - error if the invoker is not an admin
+// ============================================================================================================================
+func check_admin(stub shim.ChaincodeStubInterface) error {
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	admins, err := get_admins(stub)
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if admin == invoker {
+			return nil
+		}
+	}
+	return errors.New("The invoker '" + invoker + "' is not an admin")
+}
+
+// ============================================================================================================================
+// Get Roles - get the role -> invoker ids map from ledger
+// ============================================================================================================================
+func get_roles(stub shim.ChaincodeStubInterface) (map[string][]string, error) {
+	roles := map[string][]string{}
+	rolesAsBytes, err := stub.GetState(ROLES_KEY)
+	if err != nil {
+		return roles, errors.New("Failed to get roles")
+	}
+	if rolesAsBytes == nil {                                   //no roles granted yet
+		return roles, nil
+	}
+	err = json.Unmarshal(rolesAsBytes, &roles)                 //un stringify it aka JSON.parse()
+	if err != nil {
+		return roles, errors.New("Failed to parse roles")
+	}
+	return roles, nil
+}
+
+// ============================================================================================================================
+// Check Role - error if the invoker does not hold the role, admins hold every role
+// ============================================================================================================================
+func check_role(stub shim.ChaincodeStubInterface, role string) error {
+	if check_admin(stub) == nil {
+		return nil
+	}
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	roles, err := get_roles(stub)
+	if err != nil {
+		return err
+	}
+	if contains(roles[role], invoker) {
+		return nil
+	}
+	return errors.New("The invoker '" + invoker + "' does not have the role '" + role + "'")
+}
+
+// ============================================================================================================================
+// Grant Role - give an invoker id a role. Admin only
+//
+// Inputs - Array of Strings
+//       0     ,       1
+//     role    ,  invoker id (see whoami)
+//  "inspector", "Org1MSP.3a7b..."
+// ============================================================================================================================
+func grant_role(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting grant_role")
+	return update_role(stub, args, true)
+}
+
+// ============================================================================================================================
+// Revoke Role - take a role away from an invoker id. Admin only
+//
+// Inputs - Array of Strings
+//       0     ,       1
+//     role    ,  invoker id
+//  "inspector", "Org1MSP.3a7b..."
+// ============================================================================================================================
+func revoke_role(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting revoke_role")
+	return update_role(stub, args, false)
+}
+
+func update_role(stub shim.ChaincodeStubInterface, args []string, grant bool) pb.Response {
+	// the invoker id has a 64 char hash in it, so only the role gets the usual check
+	err := sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 {
+		return shim.Error("Argument 1 must be a non-empty string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	role := args[0]
+	invoker := args[1]
+	roles, err := get_roles(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var members []string
+	for _, member := range roles[role] {                       //drop it, then add it back if granting
+		if member != invoker {
+			members = append(members, member)
+		}
+	}
+	if grant {
+		members = append(members, invoker)
+	}
+	roles[role] = members
+
+	rolesAsBytes, _ := json.Marshal(roles)                     //convert to array of bytes
+	err = stub.PutState(ROLES_KEY, rolesAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end update role")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Who Am I - return the invoker id of the caller, this is the id to hand to grant_role
+//
+// Inputs - none
+// ============================================================================================================================
+func whoami(stub shim.ChaincodeStubInterface) pb.Response {
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(invoker))
+}
+
+// ============================================================================================================================
+// Is Paused - true if an admin has paused the system
+// ============================================================================================================================
+func is_paused(stub shim.ChaincodeStubInterface) (bool, error) {
+	pausedAsBytes, err := stub.GetState(PAUSED_KEY)
+	if err != nil {
+		return false, errors.New("Failed to get paused state")
+	}
+	return string(pausedAsBytes) == "true", nil
+}
+
+// ============================================================================================================================
+// Pause - stop all mutating functions, reads are still allowed. Admin only
+//
+// Inputs - none
+// ============================================================================================================================
+func pause(stub shim.ChaincodeStubInterface) pb.Response {
+	fmt.Println("starting pause")
+	return set_paused(stub, true)
+}
+
+// ============================================================================================================================
+// Unpause - let mutating functions run again. Admin only
+//
+// Inputs - none
+// ============================================================================================================================
+func unpause(stub shim.ChaincodeStubInterface) pb.Response {
+	fmt.Println("starting unpause")
+	return set_paused(stub, false)
+}
+
+func set_paused(stub shim.ChaincodeStubInterface, paused bool) pb.Response {
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	value := "false"
+	if paused {
+		value = "true"
+	}
+	err = stub.PutState(PAUSED_KEY, []byte(value))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set paused - " + value)
+	return shim.Success(nil)
+}
@@ -0,0 +1,258 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================================================================
+// Function Args - what every function expects, checked by Invoke() before the handler runs
+//
+// This is the only place arg counts are checked, handlers only look at len(args) to read their optional args. Functions
+// that are not listed are refused. Kinds are "string", "int", "float", "bool" and "json".
+// ============================================================================================================================
+type arg_spec struct {
+	name string
+	kind string
+}
+
+type function_spec struct {
+	args     []arg_spec //required, in this order
+	optional []arg_spec //may follow the required args
+	rest     *arg_spec  //one or more of these follow the required args
+}
+
+func arg(name string, kind string) arg_spec {
+	return arg_spec{name: name, kind: kind}
+}
+
+func rest(name string, kind string) *arg_spec {
+	return &arg_spec{name: name, kind: kind}
+}
+
+var function_args = map[string]function_spec{
+	"init":                       {args: []arg_spec{arg("value", "int")}}, //Init() checks its own too, the peer calls it directly
+	"read":                       {args: []arg_spec{arg("key", "string")}},
+	"write":                      {args: []arg_spec{arg("key", "string"), arg("value", "string")}},
+	"delete_marble":              {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}},
+	"init_marble":                {args: []arg_spec{arg("marble_id", "string"), arg("color", "string"), arg("size", "int"), arg("owner_id", "string"), arg("authed_by_company", "string")}, optional: []arg_spec{arg("rarity", "string"), arg("weight", "float"), arg("weight_unit", "string"), arg("length", "float"), arg("width", "float"), arg("height", "float"), arg("length_unit", "string")}},
+	"set_owner":                  {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"init_owner":                 {args: []arg_spec{arg("owner_id", "string"), arg("username", "string"), arg("company", "string")}, optional: []arg_spec{arg("invite_code", "string")}},
+	"init_owners_bulk":           {args: []arg_spec{arg("owners", "json")}},
+	"read_consistent":            {rest: rest("key", "string")},
+	"read_everything":            {optional: []arg_spec{arg("bookmark", "string")}}, //the node app sends ['']
+	"getHistory":                 {args: []arg_spec{arg("marble_id", "string")}},
+	"get_history_paginated":      {args: []arg_spec{arg("marble_id", "string"), arg("page_size", "int")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"getMarblesByRange":          {args: []arg_spec{arg("start_key", "string"), arg("end_key", "string")}},
+	"register_public_key":        {args: []arg_spec{arg("owner_id", "string"), arg("public_key", "string"), arg("authed_by_company", "string")}},
+	"set_owner_signed":           {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("signature", "string")}, optional: []arg_spec{arg("nonce", "int")}},
+	"schedule_transfer":          {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("not_before_ms", "int"), arg("authed_by_company", "string")}},
+	"execute_scheduled_transfer": {args: []arg_spec{arg("transfer_id", "string")}},
+	"cancel_scheduled_transfer":  {args: []arg_spec{arg("transfer_id", "string"), arg("authed_by_company", "string")}},
+	"split_ownership":            {args: []arg_spec{arg("marble_id", "string"), arg("approval_threshold", "int"), arg("authed_by_company", "string")}},
+	"transfer_shares":            {args: []arg_spec{arg("marble_id", "string"), arg("from_owner_id", "string"), arg("to_owner_id", "string"), arg("percent", "int"), arg("authed_by_company", "string")}},
+	"approve_transfer":           {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("approving_owner_id", "string"), arg("authed_by_company", "string")}},
+	"cancel_transfer":            {args: []arg_spec{arg("marble_id", "string"), arg("approving_owner_id", "string"), arg("authed_by_company", "string")}},
+	"transition":                 {args: []arg_spec{arg("marble_id", "string"), arg("status", "string")}},
+	"set_lifecycle":              {args: []arg_spec{arg("lifecycle", "json")}},
+	"get_lifecycle":              {},
+	"request_inspection":         {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}},
+	"record_inspection":          {args: []arg_spec{arg("marble_id", "string"), arg("result", "string"), arg("report_hash", "string")}},
+	"set_inspection_policy":      {args: []arg_spec{arg("required_for_listing", "bool"), arg("required_for_trading", "bool")}},
+	"get_inspection_policy":      {},
+	"issue_warranty":             {args: []arg_spec{arg("marble_id", "string"), arg("term_ms", "int"), arg("authed_by_company", "string")}},
+	"file_warranty_claim":        {args: []arg_spec{arg("marble_id", "string"), arg("description", "string"), arg("authed_by_company", "string")}},
+	"resolve_claim":              {args: []arg_spec{arg("marble_id", "string"), arg("claim_id", "string"), arg("resolution", "string"), arg("authed_by_company", "string")}},
+	"get_warranty":               {args: []arg_spec{arg("marble_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"notarize_document":          {args: []arg_spec{arg("marble_id", "string"), arg("doc_hash", "string"), arg("description", "string")}},
+	"verify_document":            {args: []arg_spec{arg("marble_id", "string"), arg("doc_hash", "string")}},
+	"purge_owner_pii":            {args: []arg_spec{arg("owner_id", "string")}},
+	"set_velocity_rules":         {args: []arg_spec{arg("window_ms", "int"), arg("max_marble_transfers", "int"), arg("max_owner_transfers", "int")}},
+	"get_velocity_rules":         {},
+	"clear_flag":                 {args: []arg_spec{arg("type", "string"), arg("id", "string")}},
+	"get_compliance_report":      {args: []arg_spec{arg("from_ms", "int"), arg("to_ms", "int")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_rarity_cap":             {args: []arg_spec{arg("tier", "string"), arg("cap", "int")}},
+	"get_rarity_caps":            {},
+	"get_marbles_by_rarity":      {args: []arg_spec{arg("tier", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_recipe":                 {args: []arg_spec{arg("recipe_id", "string"), arg("recipe", "json")}},
+	"get_recipe":                 {args: []arg_spec{arg("recipe_id", "string")}},
+	"craft":                      {args: []arg_spec{arg("recipe_id", "string"), arg("marble_id", "string"), arg("authed_by_company", "string")}, rest: rest("input_marble_id", "string")},
+	"get_badges":                 {args: []arg_spec{arg("owner_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_template":               {args: []arg_spec{arg("template_id", "string"), arg("template", "json")}},
+	"get_template":               {args: []arg_spec{arg("template_id", "string")}},
+	"init_marble_from_template":  {args: []arg_spec{arg("template_id", "string"), arg("marble_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"release_to_pool":            {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}},
+	"claim_from_pool":            {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"set_pool_cooldown":          {args: []arg_spec{arg("cooldown_ms", "int")}},
+	"get_operation":              {args: []arg_spec{arg("tx_id", "string")}},
+	"compensate":                 {args: []arg_spec{arg("tx_id", "string")}},
+	"set_protected":              {args: []arg_spec{arg("marble_id", "string"), arg("protected", "bool"), arg("authed_by_company", "string")}},
+	"request_delete":             {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}},
+	"approve_delete":             {args: []arg_spec{arg("marble_id", "string")}},
+	"tag_marble":                 {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}, rest: rest("tag", "string")},
+	"untag_marble":               {args: []arg_spec{arg("marble_id", "string"), arg("authed_by_company", "string")}, rest: rest("tag", "string")},
+	"get_marbles_by_tag":         {args: []arg_spec{arg("tag", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_metadata":               {args: []arg_spec{arg("marble_id", "string"), arg("uri", "string"), arg("hash", "string"), arg("authed_by_company", "string")}},
+	"set_physical":               {args: []arg_spec{arg("marble_id", "string"), arg("weight", "float"), arg("weight_unit", "string"), arg("length", "float"), arg("width", "float"), arg("height", "float"), arg("length_unit", "string"), arg("authed_by_company", "string")}},
+	"set_allowed_units":          {args: []arg_spec{arg("kind", "string")}, rest: rest("unit", "string")},
+	"get_allowed_units":          {},
+	"get_marbles_by_size_range":  {args: []arg_spec{arg("min", "float"), arg("max", "float"), arg("unit", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"record_location":            {args: []arg_spec{arg("marble_id", "string"), arg("lat", "float"), arg("lon", "float"), arg("facility", "string")}},
+	"get_location_history":       {args: []arg_spec{arg("marble_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_description":            {args: []arg_spec{arg("marble_id", "string"), arg("description", "string"), arg("notes", "string"), arg("authed_by_company", "string")}},
+	"search_text":                {args: []arg_spec{arg("text", "string")}, optional: []arg_spec{arg("bookmark", "int")}},
+	"get_recent_activity":        {args: []arg_spec{arg("limit", "int")}},
+	"rebuild_indexes_from_state": {},
+	"set_size_bounds":            {args: []arg_spec{arg("min", "int"), arg("max", "int")}},
+	"get_size_bounds":            {},
+	"watch":                      {args: []arg_spec{arg("marble_id", "string")}},
+	"unwatch":                    {args: []arg_spec{arg("marble_id", "string")}},
+	"get_watchlist":              {args: []arg_spec{arg("invoker_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"create_invites":             {rest: rest("code_hash", "string")},
+	"set_invites_required":       {args: []arg_spec{arg("required", "bool")}},
+	"set_daily_transfer_limit":   {args: []arg_spec{arg("limit", "int")}, optional: []arg_spec{arg("owner_id", "string")}},
+	"get_daily_transfer_limit":   {args: []arg_spec{arg("owner_id", "string")}},
+	"set_mint_quota":             {args: []arg_spec{arg("msp_id", "string"), arg("color", "string"), arg("quota", "int")}},
+	"get_mint_quota":             {args: []arg_spec{arg("msp_id", "string"), arg("color", "string")}},
+	"state_digest":               {args: []arg_spec{arg("doc_type", "string")}},
+	"diff_marble":                {args: []arg_spec{arg("marble_id", "string"), arg("tx_id_a", "string"), arg("tx_id_b", "string")}},
+	"get_transfer_receipts":      {args: []arg_spec{arg("marble_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"set_max_results":            {args: []arg_spec{arg("max", "int")}},
+	"get_max_results":            {},
+	"create_drop":                {args: []arg_spec{arg("template_id", "string"), arg("count", "int"), arg("start_ms", "int")}},
+	"claim_drop":                 {args: []arg_spec{arg("drop_id", "string"), arg("marble_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"get_drop":                   {args: []arg_spec{arg("drop_id", "string")}},
+	"set_nonce_required":         {args: []arg_spec{arg("owner_id", "string"), arg("required", "bool"), arg("authed_by_company", "string")}},
+	"get_nonce":                  {args: []arg_spec{arg("owner_id", "string")}},
+	"set_contact_info":           {args: []arg_spec{arg("owner_id", "string"), arg("authed_by_company", "string")}}, //details come in the transient map
+	"get_my_contact_info":        {args: []arg_spec{arg("owner_id", "string")}},
+	"set_beneficiary":            {args: []arg_spec{arg("owner_id", "string"), arg("beneficiary_id", "string"), arg("inactivity_ms", "int"), arg("authed_by_company", "string")}},
+	"check_in":                   {args: []arg_spec{arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"claim_inheritance":          {args: []arg_spec{arg("owner_id", "string"), arg("beneficiary_id", "string"), arg("authed_by_company", "string")}},
+	"get_beneficiary":            {args: []arg_spec{arg("owner_id", "string")}},
+	"query_marbles_by_owner":     {args: []arg_spec{arg("owner_id", "string")}, optional: []arg_spec{arg("bookmark", "int")}},
+	"create_desk":                {args: []arg_spec{arg("desk_id", "string"), arg("name", "string"), arg("company", "string")}},
+	"add_desk_member":            {args: []arg_spec{arg("desk_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"remove_desk_member":         {args: []arg_spec{arg("desk_id", "string"), arg("owner_id", "string"), arg("authed_by_company", "string")}},
+	"desk_transfer":              {args: []arg_spec{arg("marble_id", "string"), arg("owner_id", "string"), arg("member_id", "string"), arg("authed_by_company", "string")}},
+	"get_desk":                   {args: []arg_spec{arg("desk_id", "string")}},
+	"get_desk_audit":             {args: []arg_spec{arg("desk_id", "string")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"list_marbles":               {args: []arg_spec{arg("page_size", "int")}, optional: []arg_spec{arg("bookmark", "string")}},
+	"get_marble_by_serial":       {args: []arg_spec{arg("color", "string"), arg("serial", "int")}},
+	"register_doc_type":          {args: []arg_spec{arg("doc_type", "string"), arg("definition", "json")}},
+	"get_doc_types":              {},
+	"put_custom_doc":             {args: []arg_spec{arg("doc_type", "string"), arg("doc_id", "string"), arg("doc", "json")}},
+	"get_custom_doc":             {args: []arg_spec{arg("doc_type", "string"), arg("doc_id", "string")}},
+	"get_marble_history":         {args: []arg_spec{arg("marble_id", "string")}},
+	"get_marble_by_fingerprint":  {args: []arg_spec{arg("fingerprint", "string")}},
+	"get_identity":               {},
+	"set_owner_identity":         {args: []arg_spec{arg("owner_id", "string"), arg("identity", "string")}},
+	"reconcile_ownership":        {args: []arg_spec{arg("snapshot", "json"), arg("confirm", "bool")}},
+	"grant_role":                 {args: []arg_spec{arg("role", "string"), arg("invoker_id", "string")}},
+	"revoke_role":                {args: []arg_spec{arg("role", "string"), arg("invoker_id", "string")}},
+	"whoami":                     {},
+	"pause":                      {},
+	"unpause":                    {},
+}
+
+// ============================================================================================================================
+// Check Args - check the count and kinds of a function's args against function_args
+//
+// Errors look like - "init_marble expects 5 to 6 args: marble_id(string), color(string), size(int), ..., [rarity(string)]"
+// ============================================================================================================================
+func check_args(function string, args []string) error {
+	spec, found := function_args[function]
+	if !found {
+		return errors.New("Received unknown invoke function name - '" + function + "'")
+	}
+
+	min := len(spec.args)
+	max := len(spec.args) + len(spec.optional)
+	if spec.rest != nil {
+		min++
+		max = -1                                                 //no limit
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return errors.New(function + " expects " + describe_count(min, max) + ": " + describe_args(spec) + ", got " + strconv.Itoa(len(args)))
+	}
+
+	for i, value := range args {
+		var expected arg_spec
+		if i < len(spec.args) {
+			expected = spec.args[i]
+		} else if spec.rest != nil {
+			expected = *spec.rest
+		} else {
+			expected = spec.optional[i - len(spec.args)]
+		}
+		if !is_kind(value, expected.kind) {
+			return errors.New(function + " arg " + strconv.Itoa(i) + " (" + expected.name + ") must be " + expected.kind + ", got '" + value + "'")
+		}
+	}
+	return nil
+}
+
+func is_kind(value string, kind string) bool {
+	var err error
+	switch kind {
+	case "int":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "float":
+		_, err = strconv.ParseFloat(value, 64)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "json":
+		var parsed interface{}
+		err = json.Unmarshal([]byte(value), &parsed)
+	}
+	return err == nil
+}
+
+func describe_count(min int, max int) string {
+	if max < 0 {
+		return "at least " + strconv.Itoa(min) + " args"
+	}
+	if min == max {
+		return strconv.Itoa(min) + " args"
+	}
+	return strconv.Itoa(min) + " to " + strconv.Itoa(max) + " args"
+}
+
+func describe_args(spec function_spec) string {
+	names := []string{}
+	for _, a := range spec.args {
+		names = append(names, a.name + "(" + a.kind + ")")
+	}
+	for _, a := range spec.optional {
+		names = append(names, "[" + a.name + "(" + a.kind + ")]")
+	}
+	if spec.rest != nil {
+		names = append(names, spec.rest.name + "(" + spec.rest.kind + ")...")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,44 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgCountsComeFromFunctionArgs(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	for function, spec := range function_args {
+		if len(spec.args) == 0 && spec.rest == nil {
+			continue
+		}
+		response := stub.must_fail(t, admin, function)
+		if !strings.Contains(response.Message, function + " expects ") {
+			t.Fatalf("%s with no args should fail in check_args, got %q", function, response.Message)
+		}
+	}
+
+	response := stub.must_fail(t, admin, "perform_trade", "m1")
+	if !strings.Contains(response.Message, "unknown invoke function") {
+		t.Fatalf("unlisted functions should be refused, got %q", response.Message)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Badge Definitions - badges are awarded automatically, once per owner
+//
+// Holdings are counted from when this code was deployed, marbles created before that are not in the count.
+// ============================================================================================================================
+const BADGE_FIRST_TRADE = "first_trade"
+const BADGE_COLLECTOR = "collector"                              //owns COLLECTOR_HOLDINGS marbles at once
+const COLLECTOR_HOLDINGS = 10
+
+type Badge struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	OwnerId    string `json:"ownerId"`
+	Badge      string `json:"badge"`
+	AwardedAt  int64  `json:"awardedAt"` //ms, tx time
+	TxId       string `json:"txId"`
+}
+
+// ============================================================================================================================
+// Award Badge - give an owner a badge, does nothing if they already have it
+// ============================================================================================================================
+func award_badge(stub shim.ChaincodeStubInterface, owner_id string, badge_name string) error {
+	key, err := stub.CreateCompositeKey("badge", []string{owner_id, badge_name})
+	if err != nil {
+		return err
+	}
+	existingAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to get badge")
+	}
+	if existingAsBytes != nil {
+		return nil
+	}
+
+	var badge Badge
+	badge.ObjectType = "badge"
+	badge.OwnerId = owner_id
+	badge.Badge = badge_name
+	badge.TxId = stub.GetTxID()
+	badge.AwardedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	badgeAsBytes, _ := json.Marshal(badge)                       //convert to array of bytes
+	return stub.PutState(key, badgeAsBytes)
+}
+
+// ============================================================================================================================
+// Record Trade Badges - called on every transfer, moves the holdings counts and awards first trade badges
+// ============================================================================================================================
+func record_trade_badges(stub shim.ChaincodeStubInterface, from_owner_id string, to_owner_id string) error {
+	err := track_holdings(stub, from_owner_id, -1)
+	if err != nil {
+		return err
+	}
+	err = track_holdings(stub, to_owner_id, 1)
+	if err != nil {
+		return err
+	}
+	err = award_badge(stub, from_owner_id, BADGE_FIRST_TRADE)
+	if err != nil {
+		return err
+	}
+	return award_badge(stub, to_owner_id, BADGE_FIRST_TRADE)
+}
+
+// ============================================================================================================================
+// Track Holdings - add delta to the number of marbles an owner holds, awards the collector badge
+// ============================================================================================================================
+func track_holdings(stub shim.ChaincodeStubInterface, owner_id string, delta int) error {
+	key, err := stub.CreateCompositeKey("holdings", []string{owner_id})
+	if err != nil {
+		return err
+	}
+	countAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to get holdings")
+	}
+	count := 0
+	if countAsBytes != nil {
+		count, _ = strconv.Atoi(string(countAsBytes))
+	}
+
+	count += delta
+	if count < 0 {                                               //marble was created before we were counting
+		count = 0
+	}
+	err = stub.PutState(key, []byte(strconv.Itoa(count)))
+	if err != nil {
+		return err
+	}
+
+	if count >= COLLECTOR_HOLDINGS {
+		return award_badge(stub, owner_id, BADGE_COLLECTOR)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Get Badges - read every badge an owner has earned
+//
+// Inputs - Array of Strings
+//        0         ,  1 (optional)
+//     owner id     ,    bookmark
+//  "o9999999999999", "collector"
+// ============================================================================================================================
+func get_badges(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var badges []Badge
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("badge", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(keyParts[1]) {
+			continue
+		}
+		if results.full(keyParts[1]) {
+			break
+		}
+		var badge Badge
+		json.Unmarshal(queryResponse.Value, &badge)              //un stringify it aka JSON.parse()
+		badges = append(badges, badge)
+	}
+
+	return results.response(badges)
+}
@@ -0,0 +1,127 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Size Bounds Definitions - every new marble's size must be within these, in mm
+// ============================================================================================================================
+const SIZE_BOUNDS_KEY = "_size_bounds"
+
+type SizeBounds struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// used until an admin changes them with set_size_bounds()
+var default_size_bounds = SizeBounds{Min: 1, Max: 1000}
+
+// ============================================================================================================================
+// Set Size Bounds - set the smallest and largest size a new marble can have. Admin only
+//
+// Marbles that already exist are left alone.
+//
+// Inputs - Array of Strings
+//    0  ,   1
+//   min ,  max
+//   "5" , "100"
+// ============================================================================================================================
+func set_size_bounds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var bounds SizeBounds
+	var err error
+	fmt.Println("starting set_size_bounds")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bounds.Min, err = strconv.Atoi(args[0])
+	if err != nil || bounds.Min <= 0 {
+		return shim.Error("1st argument must be a positive numeric string")
+	}
+	bounds.Max, err = strconv.Atoi(args[1])
+	if err != nil || bounds.Max < bounds.Min {
+		return shim.Error("2nd argument must be a numeric string >= the 1st")
+	}
+
+	boundsAsBytes, _ := json.Marshal(bounds)                     //convert to array of bytes
+	err = stub.PutState(SIZE_BOUNDS_KEY, boundsAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_size_bounds")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Size Bounds - read the marble size bounds
+//
+// Inputs - none
+// ============================================================================================================================
+func get_size_bounds(stub shim.ChaincodeStubInterface) pb.Response {
+	bounds, err := get_size_bounds_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	boundsAsBytes, _ := json.Marshal(bounds)                     //convert to array of bytes
+	return shim.Success(boundsAsBytes)
+}
+
+// ============================================================================================================================
+// Size Bounds helpers
+// ============================================================================================================================
+func get_size_bounds_config(stub shim.ChaincodeStubInterface) (SizeBounds, error) {
+	bounds := default_size_bounds
+	boundsAsBytes, err := stub.GetState(SIZE_BOUNDS_KEY)
+	if err != nil {
+		return bounds, errors.New("Failed to get size bounds")
+	}
+	if boundsAsBytes == nil {
+		return bounds, nil
+	}
+	err = json.Unmarshal(boundsAsBytes, &bounds)                 //un stringify it aka JSON.parse()
+	if err != nil {
+		return bounds, errors.New("Failed to parse size bounds")
+	}
+	return bounds, nil
+}
+
+func check_size(stub shim.ChaincodeStubInterface, size int) error {
+	bounds, err := get_size_bounds_config(stub)
+	if err != nil {
+		return err
+	}
+	if size < bounds.Min || size > bounds.Max {
+		return errors.New("Marble size must be between " + strconv.Itoa(bounds.Min) + " and " + strconv.Itoa(bounds.Max))
+	}
+	return nil
+}
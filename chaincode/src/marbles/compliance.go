@@ -0,0 +1,155 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Flag Event Definitions - every flag and clear, kept by time so a report still shows flags that were cleared since
+// ============================================================================================================================
+type FlagEvent struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	Kind       string `json:"kind"`    //"marble" or "owner"
+	Id         string `json:"id"`
+	Action     string `json:"action"` //"flagged" or "cleared"
+	Timestamp  int64  `json:"timestamp"`
+	TxId       string `json:"txId"`
+}
+
+// ============================================================================================================================
+// Get Compliance Report - every flag and clear in a time range, for hand off to a compliance team. Compliance role only
+//
+// Flags come from the velocity rules (see velocity.go), clears from clear_flag(). There are no disputes or priced
+// transfers in this chaincode, so those sections do not exist.
+//
+// Inputs - Array of Strings
+//        0       ,        1       ,    2 (optional)
+//     from ms    ,      to ms     ,      bookmark
+//  "1490000000000", "1500000000000", "001490898165086:2b2d7c4c...:marble:m1490898165086"
+//
+// Returns:
+// {
+//	"from": 1490000000000,
+//	"to": 1500000000000,
+//	"events": [{"kind": "marble", "id": "m1490898165086", "action": "flagged", "timestamp": 1490898165086, ...}]
+// }
+// ============================================================================================================================
+func get_compliance_report(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type ComplianceReport struct {
+		From   int64       `json:"from"`
+		To     int64       `json:"to"`
+		Events []FlagEvent `json:"events"`
+	}
+	var report ComplianceReport
+	var err error
+	fmt.Println("starting get_compliance_report")
+
+	report.From, err = strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return shim.Error("1st argument must be a numeric string")
+	}
+	report.To, err = strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return shim.Error("2nd argument must be a numeric string")
+	}
+	bookmark := ""
+	if len(args) == 3 {
+		bookmark = args[2]
+	}
+
+	err = check_role(stub, "compliance")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ---- Get Flag Events ---- //
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("flag_event", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var event FlagEvent
+		json.Unmarshal(queryResponse.Value, &event)              //un stringify it aka JSON.parse()
+		if event.Timestamp < report.From {
+			continue
+		}
+		if event.Timestamp > report.To {                         //keys are in time order, the rest are later
+			break
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position := strings.Join(keyParts, ":")                  //tx time, tx id, kind, id - sorts the same as the keys
+		if results.skip(position) {
+			continue
+		}
+		if results.full(position) {
+			break
+		}
+		report.Events = append(report.Events, event)
+	}
+
+	fmt.Println("- end get_compliance_report")
+	return results.response(report)
+}
+
+// ============================================================================================================================
+// Put Flag Event - record a marble/owner being flagged or cleared, under its tx time
+// ============================================================================================================================
+func put_flag_event(stub shim.ChaincodeStubInterface, kind string, id string, action string) error {
+	var event FlagEvent
+	var err error
+	event.ObjectType = "flag_event"
+	event.Kind = kind
+	event.Id = id
+	event.Action = action
+	event.TxId = stub.GetTxID()
+	event.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	key, err := stub.CreateCompositeKey(event.ObjectType, []string{fmt.Sprintf("%015d", event.Timestamp), event.TxId, event.Kind, event.Id})
+	if err != nil {
+		return err
+	}
+	eventAsBytes, _ := json.Marshal(event)                       //convert to array of bytes
+	return stub.PutState(key, eventAsBytes)
+}
@@ -0,0 +1,61 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestComplianceReportKeepsClearedFlags(t *testing.T) {
+	stub, admin, alice, mallory := new_identity_fixture(t)
+	stub.must(t, admin, "set_velocity_rules", "60000", "1", "0")
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	stub.now += 1000
+	stub.must(t, mallory, "set_owner", "m1", "o1", COMPANY)       //2nd transfer in the window flags m1
+	if !stub.marble(t, "m1").Flagged {
+		t.Fatal("m1 should be flagged")
+	}
+	stub.now += 1000
+	stub.must(t, admin, "clear_flag", "marble", "m1")
+
+	var report struct {
+		Events []FlagEvent `json:"events"`
+	}
+	response := stub.must(t, admin, "get_compliance_report", "0", "9999999999999")
+	json.Unmarshal(response.Payload, &report)
+	if len(report.Events) != 2 || report.Events[0].Action != "flagged" || report.Events[1].Action != "cleared" {
+		t.Fatalf("the report should show the flag and the clear - %s", response.Payload)
+	}
+
+	stub.must(t, admin, "set_max_results", "1")
+	var page ResultPage
+	response = stub.must(t, admin, "get_compliance_report", "0", "9999999999999")
+	json.Unmarshal(response.Payload, &page)
+	if !page.Truncated {
+		t.Fatalf("the report should be capped - %s", response.Payload)
+	}
+	response = stub.must(t, admin, "get_compliance_report", "0", "9999999999999", page.Bookmark)
+	json.Unmarshal(response.Payload, &report)
+	if len(report.Events) != 1 || report.Events[0].Action != "cleared" {
+		t.Fatalf("the bookmark should pick up at the clear - %s", response.Payload)
+	}
+}
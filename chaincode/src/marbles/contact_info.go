@@ -0,0 +1,167 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Contact Info Definitions - how an owner wants to be told about things, kept off the public ledger
+//
+// Stored in the CONTACT_COLLECTION private data collection (see collections_config.json, pass it when instantiating),
+// so only the peers of orgs in the collection hold it, the channel only sees a hash. The details come in the transient
+// map so they aren't in the proposal either. The event/webhook layer reads them with get_my_contact_info().
+// ============================================================================================================================
+const CONTACT_COLLECTION = "ownerContactInfo"
+const CONTACT_TRANSIENT_KEY = "contact_info"
+
+type ContactInfo struct {
+	ObjectType string   `json:"docType"` //field for couchdb
+	OwnerId    string   `json:"ownerId"`
+	Email      string   `json:"email"`
+	Phone      string   `json:"phone"`
+	Webhook    string   `json:"webhook"` //url to post notifications to
+	Notify     []string `json:"notify"`  //event names to send, e.g. "marble_watch", none is all
+}
+
+// ============================================================================================================================
+// Set Contact Info - store an owner's contact details + notification preferences
+//
+// Inputs - Array of Strings
+//           0     ,         1
+//      owner id   ,  authing company
+// "o9999999999999", "united marbles"
+//
+// Transient - "contact_info": {"email": "alice@example.com", "webhook": "https://...", "notify": ["marble_watch"]}
+// ============================================================================================================================
+func set_contact_info(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_contact_info")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	authed_by_company := args[1]
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize contact info for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can set its contact info
+	err = check_owner_identity(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient data")
+	}
+	contactAsBytes, ok := transient[CONTACT_TRANSIENT_KEY]
+	if !ok {
+		return shim.Error("Contact info must be passed in the transient map as '" + CONTACT_TRANSIENT_KEY + "'")
+	}
+	var contact ContactInfo
+	err = json.Unmarshal(contactAsBytes, &contact)               //un stringify it aka JSON.parse()
+	if err != nil {
+		return shim.Error("Failed to parse contact info")
+	}
+	contact.ObjectType = "contact_info"
+	contact.OwnerId = owner.Id
+
+	err = put_contact_info(stub, contact)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_contact_info")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get My Contact Info - read an owner's contact details, only works on peers of orgs in the collection
+//
+// Inputs - Array of Strings
+//           0
+//      owner id
+// "o9999999999999"
+// ============================================================================================================================
+func get_my_contact_info(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// only the owner's identity (or an admin) can read its contact info
+	err := check_owner_identity(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("contact_info", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	contactAsBytes, err := stub.GetPrivateData(CONTACT_COLLECTION, key)
+	if err != nil {
+		return shim.Error("Failed to get contact info")
+	}
+	if contactAsBytes == nil {
+		return shim.Error("Owner has no contact info - " + args[0])
+	}
+	return shim.Success(contactAsBytes)
+}
+
+// ============================================================================================================================
+// Contact Info helpers
+// ============================================================================================================================
+func put_contact_info(stub shim.ChaincodeStubInterface, contact ContactInfo) error {
+	key, err := stub.CreateCompositeKey(contact.ObjectType, []string{contact.OwnerId})
+	if err != nil {
+		return err
+	}
+	contactAsBytes, _ := json.Marshal(contact)                   //convert to array of bytes
+	return stub.PutPrivateData(CONTACT_COLLECTION, key, contactAsBytes)
+}
+
+// drop an owner's contact info, if there is any
+func delete_contact_info(stub shim.ChaincodeStubInterface, owner_id string) error {
+	key, err := stub.CreateCompositeKey("contact_info", []string{owner_id})
+	if err != nil {
+		return err
+	}
+	err = stub.DelPrivateData(CONTACT_COLLECTION, key)
+	if err != nil {
+		return errors.New("Failed to delete contact info")
+	}
+	return nil
+}
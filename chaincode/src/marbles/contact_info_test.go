@@ -0,0 +1,53 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestContactInfoStaysPrivate(t *testing.T) {
+	stub, admin, alice, mallory := new_identity_fixture(t)
+	stub.must_fail(t, alice, "set_contact_info", "o1", COMPANY)   //nothing in the transient map
+	stub.transient = map[string][]byte{CONTACT_TRANSIENT_KEY: []byte(`{"email": "alice@example.com", "notify": ["marble_watch"]}`)}
+	stub.must_fail(t, mallory, "set_contact_info", "o1", COMPANY)
+	stub.must(t, alice, "set_contact_info", "o1", COMPANY)
+	stub.transient = nil
+
+	for key, value := range stub.State {
+		if bytes.Contains(value, []byte("alice@example.com")) {
+			t.Fatalf("contact info is on the public ledger under %q", key)
+		}
+	}
+
+	stub.must_fail(t, mallory, "get_my_contact_info", "o1")
+	var contact ContactInfo
+	response := stub.must(t, alice, "get_my_contact_info", "o1")
+	json.Unmarshal(response.Payload, &contact)
+	if contact.Email != "alice@example.com" || contact.OwnerId != "o1" {
+		t.Fatalf("alice should read the contact info back - %s", response.Payload)
+	}
+
+	stub.must(t, admin, "purge_owner_pii", "o1")
+	stub.must_fail(t, admin, "get_my_contact_info", "o1")         //purged with the rest
+}
@@ -0,0 +1,393 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Split Ownership - turn a marble into a co-owned marble, the current owner starts with 100% of the shares
+//
+// Inputs - Array of Strings
+//       0     ,          1           ,         2
+//  marble id  ,  approval threshold  ,  authing company
+// "m999999999",        "51"          , "united marbles"
+// ============================================================================================================================
+func split_ownership(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting split_ownership")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[2]
+	threshold, err := strconv.Atoi(args[1])
+	if err != nil || threshold < 1 || threshold > 100 {
+		return shim.Error("2nd argument must be a numeric string between 1 and 100")
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize co-ownership for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can split it
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(marble.Shares) > 0 {
+		return shim.Error("Marble is already co-owned - " + marble_id)
+	}
+
+	marble.Shares = []Share{{OwnerId: marble.Owner.Id, Percent: 100}}
+	marble.ApprovalThreshold = threshold
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end split_ownership")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Transfer Shares - move a percent of a co-owned marble from one share holder to another owner
+//
+// The marble's owner follows the shares, it's whoever holds the most. On a tie the current owner keeps it.
+// A new owner is a transfer like set_owner(), so the trading rules apply and it gets a receipt.
+//
+// Inputs - Array of Strings
+//       0     ,        1       ,       2      ,    3    ,         4
+//  marble id  , from owner id  , to owner id  , percent , company of the from owner
+// "m999999999", "o99999999999" , "o8888888888",   "25"  , "united marbles"
+// ============================================================================================================================
+func transfer_shares(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting transfer_shares")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	from_owner_id := args[1]
+	to_owner_id := args[2]
+	authed_by_company := args[4]
+	percent, err := strconv.Atoi(args[3])
+	if err != nil || percent < 1 {
+		return shim.Error("4th argument must be a positive numeric string")
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(marble.Shares) == 0 {
+		return shim.Error("Marble is not co-owned - " + marble_id)
+	}
+
+	from_owner, err := get_owner(stub, from_owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if from_owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize share transfers for '" + from_owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can give its shares away
+	err = check_owner_identity(stub, from_owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if to_owner_id == POOL_OWNER_ID {                            //the pool only takes whole marbles, see release_to_pool()
+		return shim.Error("Shares cannot be given to the pool")
+	}
+	to_owner, err := get_owner(stub, to_owner_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + to_owner_id)
+	}
+
+	// flagged marbles/owners cannot trade shares either, see check_velocity()
+	if marble.Flagged {
+		return shim.Error("Marble is flagged for review and cannot be traded - " + marble_id)
+	}
+	for _, owner := range []Owner{from_owner, to_owner} {
+		if owner.Flagged {
+			return shim.Error("Owner is flagged for review and cannot trade - " + owner.Id)
+		}
+	}
+
+	// move the percent
+	if share_percent(marble, from_owner_id) < percent {
+		return shim.Error("Owner '" + from_owner_id + "' does not hold " + strconv.Itoa(percent) + "% of " + marble_id)
+	}
+	marble.Shares = add_shares(marble.Shares, from_owner_id, -percent)
+	marble.Shares = add_shares(marble.Shares, to_owner_id, percent)
+
+	// hand the marble to the new lead share holder, that is a transfer so the same rules and records apply
+	lead_id := lead_share_holder(marble)
+	if lead_id != marble.Owner.Id {
+		lead, err := get_owner(stub, lead_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = change_owner(stub, &marble, lead)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		err = put_marble(stub, marble)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end transfer_shares")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Approve Transfer - a share holder approves moving the whole co-owned marble to a new owner
+//
+// The transfer runs as soon as the approving holders own at least the marble's approval threshold.
+// The new owner holds the marble outright afterwards, co-ownership ends.
+//
+// Inputs - Array of Strings
+//       0     ,        1      ,         2          ,         3
+//  marble id  ,  to owner id  , approving owner id , company of the approving owner
+// "m999999999", "o99999999999",   "o8888888888"    , "united marbles"
+// ============================================================================================================================
+func approve_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting approve_transfer")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	to_owner_id := args[1]
+	approver_id := args[2]
+	authed_by_company := args[3]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(marble.Shares) == 0 {
+		return shim.Error("Marble is not co-owned, use set_owner - " + marble_id)
+	}
+
+	approver, err := get_owner(stub, approver_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if approver.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize approvals for '" + approver.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can approve for it
+	err = check_owner_identity(stub, approver_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if share_percent(marble, approver_id) == 0 {
+		return shim.Error("Owner '" + approver_id + "' holds no shares of " + marble_id)
+	}
+
+	new_owner, err := get_owner(stub, to_owner_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + to_owner_id)
+	}
+
+	// record the approval against the pending transfer
+	if marble.PendingTransfer == nil {
+		marble.PendingTransfer = &PendingTransfer{ToOwnerId: to_owner_id}
+	}
+	if marble.PendingTransfer.ToOwnerId != to_owner_id {
+		return shim.Error("A transfer to '" + marble.PendingTransfer.ToOwnerId + "' is already pending for " + marble_id)
+	}
+	if !contains(marble.PendingTransfer.Approvals, approver_id) {
+		marble.PendingTransfer.Approvals = append(marble.PendingTransfer.Approvals, approver_id)
+	}
+
+	// tally approvals by current shares
+	approved := 0
+	for _, id := range marble.PendingTransfer.Approvals {
+		approved += share_percent(marble, id)
+	}
+
+	if approved < marble.ApprovalThreshold {                     //not enough yet, just store the approval
+		err = put_marble(stub, marble)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		fmt.Println("- end approve_transfer, approved " + strconv.Itoa(approved) + "%")
+		return shim.Success(nil)
+	}
+
+	// threshold met, co-ownership ends and the marble moves
+	marble.Shares = nil
+	marble.ApprovalThreshold = 0
+	marble.PendingTransfer = nil
+	err = transfer_marble(stub, &marble, new_owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end approve_transfer, transferred")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Cancel Transfer - a share holder withdraws their approval of the pending transfer
+//
+// The pending transfer is dropped once nobody approves it any more, then a transfer to someone else can be approved.
+//
+// Inputs - Array of Strings
+//       0     ,         1          ,         2
+//  marble id  , approving owner id , company of the approving owner
+// "m999999999",   "o8888888888"    , "united marbles"
+// ============================================================================================================================
+func cancel_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting cancel_transfer")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	approver_id := args[1]
+	authed_by_company := args[2]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.PendingTransfer == nil {
+		return shim.Error("No transfer is pending for " + marble_id)
+	}
+
+	approver, err := get_owner(stub, approver_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if approver.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize approvals for '" + approver.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can withdraw its approval
+	err = check_owner_identity(stub, approver_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !contains(marble.PendingTransfer.Approvals, approver_id) {
+		return shim.Error("Owner '" + approver_id + "' has not approved the pending transfer of " + marble_id)
+	}
+
+	var approvals []string
+	for _, id := range marble.PendingTransfer.Approvals {
+		if id != approver_id {
+			approvals = append(approvals, id)
+		}
+	}
+	marble.PendingTransfer.Approvals = approvals
+	if len(approvals) == 0 {                                     //nobody wants it any more
+		marble.PendingTransfer = nil
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end cancel_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Share helpers
+// ============================================================================================================================
+func share_percent(marble Marble, owner_id string) int {
+	for _, share := range marble.Shares {
+		if share.OwnerId == owner_id {
+			return share.Percent
+		}
+	}
+	return 0
+}
+
+// whoever holds the most shares, the current owner wins a tie
+func lead_share_holder(marble Marble) string {
+	lead_id := marble.Owner.Id
+	lead_percent := share_percent(marble, lead_id)
+	for _, share := range marble.Shares {
+		if share.Percent > lead_percent {
+			lead_id = share.OwnerId
+			lead_percent = share.Percent
+		}
+	}
+	return lead_id
+}
+
+// add (or subtract) percent for an owner, drops holders that reach 0
+func add_shares(shares []Share, owner_id string, percent int) []Share {
+	var result []Share
+	found := false
+	for _, share := range shares {
+		if share.OwnerId == owner_id {
+			share.Percent += percent
+			found = true
+		}
+		if share.Percent > 0 {
+			result = append(result, share)
+		}
+	}
+	if !found && percent > 0 {
+		result = append(result, Share{OwnerId: owner_id, Percent: percent})
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCoOwnedMarbleCannotBeDeleted(t *testing.T) {
+	stub, admin, alice, _ := new_identity_fixture(t)
+	stub.must(t, alice, "split_ownership", "m1", "51", COMPANY)
+	stub.must(t, alice, "transfer_shares", "m1", "o1", "o2", "40", COMPANY)
+
+	stub.must_fail(t, alice, "delete_marble", "m1", COMPANY)
+	stub.must_fail(t, admin, "delete_marble", "m1", COMPANY)
+	stub.marble(t, "m1")                                          //still there
+}
+
+func TestOwnerFollowsLeadShareHolder(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	stub.must(t, alice, "split_ownership", "m1", "51", COMPANY)
+
+	stub.must(t, alice, "transfer_shares", "m1", "o1", "o2", "60", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o2" {
+		t.Fatal("o2 holds the most shares and should own the marble")
+	}
+	if stub.holdings("o1") != "0" || stub.holdings("o2") != "1" {
+		t.Fatalf("holdings should be 0 and 1, got %s and %s", stub.holdings("o1"), stub.holdings("o2"))
+	}
+
+	// a tie leaves it where it is
+	stub.must(t, mallory, "transfer_shares", "m1", "o2", "o1", "10", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o2" {
+		t.Fatal("a tie should not move the marble")
+	}
+}
+
+func TestCancelTransfer(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	stub.must(t, alice, "split_ownership", "m1", "100", COMPANY)
+	stub.must(t, alice, "transfer_shares", "m1", "o1", "o2", "50", COMPANY)
+	stub.must(t, alice, "approve_transfer", "m1", "o2", "o1", COMPANY)
+	stub.must_fail(t, alice, "approve_transfer", "m1", "o1", "o1", COMPANY)
+
+	stub.must_fail(t, mallory, "cancel_transfer", "m1", "o2", COMPANY) //never approved
+	stub.must(t, alice, "cancel_transfer", "m1", "o1", COMPANY)
+	if stub.marble(t, "m1").PendingTransfer != nil {
+		t.Fatal("pending transfer should be gone once nobody approves it")
+	}
+	stub.must(t, alice, "approve_transfer", "m1", "o1", "o1", COMPANY)
+	stub.must_fail(t, alice, "cancel_transfer", "m1", "o2", COMPANY) //alice isn't o2
+}
+
+func TestShareTransfersFollowTheTradingRules(t *testing.T) {
+	stub, admin, alice, _ := new_identity_fixture(t)
+	stub.must(t, alice, "split_ownership", "m1", "51", COMPANY)
+	stub.must_fail(t, alice, "transfer_shares", "m1", "o1", POOL_OWNER_ID, "10", COMPANY)
+
+	// a new lead share holder is held to the inspection rule
+	stub.must(t, admin, "set_inspection_policy", "false", "true")
+	stub.must_fail(t, alice, "transfer_shares", "m1", "o1", "o2", "60", COMPANY)
+	stub.must(t, alice, "transfer_shares", "m1", "o1", "o2", "10", COMPANY)   //no new lead, no transfer
+	stub.must(t, admin, "set_inspection_policy", "false", "false")
+
+	// and to the velocity rules, which a flagged marble can't get past with shares
+	stub.must(t, alice, "init_marble", "m2", "red", "35", "o1", COMPANY)
+	stub.must(t, admin, "set_velocity_rules", "60000", "0", "1")
+	stub.must(t, alice, "set_owner", "m2", "o2", COMPANY)
+	stub.must(t, admin, "set_owner", "m2", "o1", COMPANY)
+	stub.must(t, alice, "set_owner", "m2", "o2", COMPANY)                      //o1 sends 1 too many, flagged
+	stub.must_fail(t, alice, "transfer_shares", "m1", "o1", "o2", "5", COMPANY)
+
+	var receipts []TransferReceipt
+	stub.must(t, admin, "clear_flag", "owner", "o1")
+	stub.must(t, alice, "transfer_shares", "m1", "o1", "o2", "50", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o2" {
+		t.Fatal("o2 holds the most shares and should own the marble")
+	}
+	response := stub.must(t, alice, "get_transfer_receipts", "m1")
+	json.Unmarshal(response.Payload, &receipts)
+	if len(receipts) != 1 || receipts[0].ToOwnerId != "o2" {
+		t.Fatalf("the new lead should get a receipt - %s", response.Payload)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Daily Limit Definitions - a hard cap on how many transfers an owner can send per UTC day, 0 is no limit
+//
+// Unlike the velocity rules (which flag), going over a daily limit rejects the transfer.
+// The default limit is under DAILY_LIMIT_KEY, per owner limits under composite key "daily_limit" [owner id].
+// Transfers sent are counted under composite key "daily_transfers" [owner id, yyyy-mm-dd].
+// ============================================================================================================================
+const DAILY_LIMIT_KEY = "_daily_limit"
+
+type DailyLimitStatus struct {
+	OwnerId string `json:"ownerId"`
+	Day     string `json:"day"` //UTC, yyyy-mm-dd
+	Limit   int    `json:"limit"`
+	Used    int    `json:"used"`
+}
+
+// ============================================================================================================================
+// Set Daily Transfer Limit - set the default daily limit, or one owner's. Admin only
+//
+// Inputs - Array of Strings
+//     0  ,     1 (optional)
+//   limit,     owner id
+//   "10" , "o9999999999999"
+// ============================================================================================================================
+func set_daily_transfer_limit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_daily_transfer_limit")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	limit, err := strconv.Atoi(args[0])
+	if err != nil || limit < 0 {
+		return shim.Error("1st argument must be a non-negative numeric string")
+	}
+
+	key := DAILY_LIMIT_KEY
+	if len(args) == 2 {
+		_, err = get_owner(stub, args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		key, err = stub.CreateCompositeKey("daily_limit", []string{args[1]})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = stub.PutState(key, []byte(strconv.Itoa(limit)))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_daily_transfer_limit")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Daily Transfer Limit - read an owner's daily limit and how many transfers they sent today
+//
+// Inputs - Array of Strings
+//          0
+//      owner id
+//  "o9999999999999"
+// ============================================================================================================================
+func get_daily_transfer_limit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	status, _, err := get_daily_limit_status(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	statusAsBytes, _ := json.Marshal(status)                     //convert to array of bytes
+	return shim.Success(statusAsBytes)
+}
+
+// ============================================================================================================================
+// Daily Limit helpers
+// ============================================================================================================================
+
+// count a transfer sent by the owner, errors if it would go over their limit
+func check_daily_limit(stub shim.ChaincodeStubInterface, owner_id string) error {
+	if owner_id == POOL_OWNER_ID {                              //claims from the pool have their own cooldown
+		return nil
+	}
+	status, countKey, err := get_daily_limit_status(stub, owner_id)
+	if err != nil {
+		return err
+	}
+	if status.Limit > 0 && status.Used >= status.Limit {
+		return errors.New("Owner " + owner_id + " has used up their " + strconv.Itoa(status.Limit) + " transfers for " + status.Day)
+	}
+	return stub.PutState(countKey, []byte(strconv.Itoa(status.Used + 1)))
+}
+
+// the owner's limit and today's count, plus the key of today's count
+func get_daily_limit_status(stub shim.ChaincodeStubInterface, owner_id string) (DailyLimitStatus, string, error) {
+	var status DailyLimitStatus
+	status.OwnerId = owner_id
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return status, "", err
+	}
+	status.Day = time.Unix(now / 1000, 0).UTC().Format("2006-01-02")
+
+	// the owner's own limit wins over the default
+	limitKey, err := stub.CreateCompositeKey("daily_limit", []string{owner_id})
+	if err != nil {
+		return status, "", err
+	}
+	limitAsBytes, err := stub.GetState(limitKey)
+	if err != nil {
+		return status, "", errors.New("Failed to get daily limit")
+	}
+	if limitAsBytes == nil {
+		limitAsBytes, err = stub.GetState(DAILY_LIMIT_KEY)
+		if err != nil {
+			return status, "", errors.New("Failed to get daily limit")
+		}
+	}
+	if limitAsBytes != nil {
+		status.Limit, _ = strconv.Atoi(string(limitAsBytes))
+	}
+
+	countKey, err := stub.CreateCompositeKey("daily_transfers", []string{owner_id, status.Day})
+	if err != nil {
+		return status, "", err
+	}
+	countAsBytes, err := stub.GetState(countKey)
+	if err != nil {
+		return status, "", errors.New("Failed to get daily transfers")
+	}
+	if countAsBytes != nil {
+		status.Used, _ = strconv.Atoi(string(countAsBytes))
+	}
+	return status, countKey, nil
+}
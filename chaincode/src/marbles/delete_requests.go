@@ -0,0 +1,246 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Delete Request Definitions - protected marbles are deleted in two steps, owner requests then admin approves
+// ============================================================================================================================
+const DELETE_REQUEST_TTL_MS = 7 * 24 * 60 * 60 * 1000          //requests older than a week are stale
+
+type DeleteRequest struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	MarbleId    string `json:"marbleId"`
+	OwnerId     string `json:"ownerId"`     //owner at request time, if the marble moves the request is stale
+	RequestedAt int64  `json:"requestedAt"` //ms, tx time
+	ExpiresAt   int64  `json:"expiresAt"`
+}
+
+// ============================================================================================================================
+// Set Protected - turn protection on for a marble (owner), or off (admin only)
+//
+// Inputs - Array of Strings
+//       0     ,     1     ,         2
+//  marble id  , protected ,  authing company
+// "m999999999",   "true"  , "united marbles"
+// ============================================================================================================================
+func set_protected(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_protected")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[2]
+	protected, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be 'true' or 'false'")
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize protection for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can change protection
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !protected {                                              //else removing protection would be a one step delete
+		err = check_admin(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	marble.Protected = protected
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_protected")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Request Delete - owner asks for a protected marble to be deleted, replaces any stale request
+//
+// Inputs - Array of Strings
+//       0     ,         1
+//  marble id  ,  authing company
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func request_delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting request_delete")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[1]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize deletion for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can ask to delete it
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !marble.Protected {
+		return shim.Error("Marble is not protected, use delete_marble - " + marble_id)
+	}
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var request DeleteRequest
+	request.ObjectType = "delete_request"
+	request.MarbleId = marble_id
+	request.OwnerId = marble.Owner.Id
+	request.RequestedAt = now
+	request.ExpiresAt = now + DELETE_REQUEST_TTL_MS
+
+	key, err := stub.CreateCompositeKey(request.ObjectType, []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	requestAsBytes, _ := json.Marshal(request)                   //convert to array of bytes
+	err = stub.PutState(key, requestAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end request_delete")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Approve Delete - delete a protected marble that has a fresh delete request. Admin only
+//
+// Inputs - Array of Strings
+//       0
+//  marble id
+// "m999999999"
+// ============================================================================================================================
+func approve_delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting approve_delete")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	key, err := stub.CreateCompositeKey("delete_request", []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	request, err := get_delete_request(stub, key, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// stale requests don't count, the owner has to ask again
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now > request.ExpiresAt {
+		return shim.Error("Delete request for " + marble_id + " expired, the owner must request again")
+	}
+	if marble.Owner.Id != request.OwnerId {
+		return shim.Error("Marble changed owners since the delete was requested - " + marble_id)
+	}
+
+	err = remove_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete request")
+	}
+
+	fmt.Println("- end approve_delete")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Delete Request - get a delete request from ledger by its composite key
+// ============================================================================================================================
+func get_delete_request(stub shim.ChaincodeStubInterface, key string, marble_id string) (DeleteRequest, error) {
+	var request DeleteRequest
+	requestAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return request, errors.New("Failed to get delete request")
+	}
+	json.Unmarshal(requestAsBytes, &request)                     //un stringify it aka JSON.parse()
+	if request.MarbleId != marble_id {                           //test if request is actually here or just nil
+		return request, errors.New("No delete request for " + marble_id)
+	}
+	return request, nil
+}
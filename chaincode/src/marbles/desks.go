@@ -0,0 +1,394 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Desk Definitions - a trading desk is an owner that a team of owners act for
+//
+// The desk itself is a normal owner record, it holds marbles and has its own daily limit (set_daily_transfer_limit() with
+// the desk id) and velocity counts, separate from its members'. Any member can move a desk marble with desk_transfer(),
+// each one is logged under the desk with the member that did it. The identity that created the desk manages its members.
+// ============================================================================================================================
+type Desk struct {
+	ObjectType string   `json:"docType"` //field for couchdb
+	Id         string   `json:"id"`      //same as the desk's owner id
+	Members    []string `json:"members"` //owner ids
+}
+
+type DeskAuditEntry struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	DeskId     string `json:"deskId"`
+	MemberId   string `json:"memberId"`
+	MarbleId   string `json:"marbleId"`
+	ToOwnerId  string `json:"toOwnerId"`
+	TxId       string `json:"txId"`
+	Timestamp  int64  `json:"timestamp"` //ms, tx time
+}
+
+// ============================================================================================================================
+// Create Desk - create a desk owner for a company, it starts with no members
+//
+// Inputs - Array of Strings
+//           0     ,      1     ,       2
+//       desk id   ,  desk name ,    company
+// "o0000000000desk",  "fx desk", "united marbles"
+// ============================================================================================================================
+func create_desk(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var owner Owner
+	var desk Desk
+	var err error
+	fmt.Println("starting create_desk")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner.ObjectType = "marble_owner"
+	owner.Id = args[0]
+	owner.Username = normalize_name(args[1])
+	owner.Company = args[2]
+	owner.Desk = true
+	err = check_owner_id_allowed(owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner.Identity, err = get_identity_fingerprint(stub)         //whoever creates the desk manages its members
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(owner.Username) == 0 {
+		return shim.Error("Desk name must have something other than spaces")
+	}
+
+	_, err = get_owner(stub, owner.Id)
+	if err == nil {
+		return shim.Error("This owner already exists - " + owner.Id)
+	}
+
+	// desks share the username space, so a desk and a person can't be confused
+	err = index_username(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_owner(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	desk.ObjectType = "desk"
+	desk.Id = owner.Id
+	desk.Members = []string{}
+	err = put_desk(stub, desk)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end create_desk")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Add Desk Member - let an owner act for a desk, they must be at the desk's company
+//
+// Inputs - Array of Strings
+//           0      ,        1        ,         2
+//        desk id   ,     owner id    ,  authing company
+// "o0000000000desk", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func add_desk_member(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting add_desk_member")
+	return update_desk_members(stub, args, true)
+}
+
+// ============================================================================================================================
+// Remove Desk Member - stop an owner acting for a desk
+//
+// Inputs - Array of Strings
+//           0      ,        1        ,         2
+//        desk id   ,     owner id    ,  authing company
+// "o0000000000desk", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func remove_desk_member(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting remove_desk_member")
+	return update_desk_members(stub, args, false)
+}
+
+func update_desk_members(stub shim.ChaincodeStubInterface, args []string, add bool) pb.Response {
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	desk_id := args[0]
+	member_id := args[1]
+	authed_by_company := args[2]
+
+	desk, desk_owner, err := get_desk_doc(stub, desk_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if desk_owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize members for '" + desk_owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can change its members
+	err = check_owner_identity(stub, desk_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if add {
+		member, err := get_owner(stub, member_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if member.Desk {
+			return shim.Error("A desk cannot be a member of a desk - " + member_id)
+		}
+		if member.Company != desk_owner.Company {
+			return shim.Error("Desk members must be at '" + desk_owner.Company + "'")
+		}
+		if contains(desk.Members, member_id) {
+			return shim.Error("Owner is already a member of desk " + desk_id)
+		}
+		desk.Members = append(desk.Members, member_id)
+	} else {
+		if !contains(desk.Members, member_id) {
+			return shim.Error("Owner is not a member of desk " + desk_id)
+		}
+		kept := []string{}
+		for _, id := range desk.Members {
+			if id != member_id {
+				kept = append(kept, id)
+			}
+		}
+		desk.Members = kept
+	}
+
+	err = put_desk(stub, desk)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end update desk members")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Desk Transfer - a desk member moves a desk marble, the desk's own limits apply
+//
+// Inputs - Array of Strings
+//       0     ,        1       ,        2        ,         3
+//  marble id  ,   to owner id  ,    member id    ,  authing company
+// "m999999999", "o88888888888", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func desk_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var entry DeskAuditEntry
+	var err error
+	fmt.Println("starting desk_transfer")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	new_owner_id := args[1]
+	member_id := args[2]
+	authed_by_company := args[3]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	desk, _, err := get_desk_doc(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error("Marble is not held by a desk - " + marble_id)
+	}
+	if !contains(desk.Members, member_id) {
+		return shim.Error("Owner is not a member of desk " + desk.Id)
+	}
+	member, err := get_owner(stub, member_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if member.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + member.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can act for the desk
+	err = check_owner_identity(stub, member_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	new_owner, err := get_owner(stub, new_owner_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + new_owner_id)
+	}
+	err = transfer_marble(stub, &marble, new_owner)             //the desk is the sender, so its limits apply
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// log it under the desk
+	entry.ObjectType = "desk_audit"
+	entry.DeskId = desk.Id
+	entry.MemberId = member_id
+	entry.MarbleId = marble_id
+	entry.ToOwnerId = new_owner_id
+	entry.TxId = stub.GetTxID()
+	entry.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(entry.ObjectType, []string{entry.DeskId, fmt.Sprintf("%015d", entry.Timestamp), entry.TxId, entry.MarbleId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	entryAsBytes, _ := json.Marshal(entry)                       //convert to array of bytes
+	err = stub.PutState(key, entryAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end desk_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Desk - read a desk's members
+//
+// Inputs - Array of Strings
+//           0
+//        desk id
+// "o0000000000desk"
+// ============================================================================================================================
+func get_desk(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	desk, _, err := get_desk_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	deskAsBytes, _ := json.Marshal(desk)                         //convert to array of bytes
+	return shim.Success(deskAsBytes)
+}
+
+// ============================================================================================================================
+// Get Desk Audit - read every desk_transfer() a desk's members made, oldest first
+//
+// Up to the result cap, if it's cut short pass the bookmark back to get the rest.
+//
+// Inputs - Array of Strings
+//           0      ,          1 (optional)
+//        desk id   ,           bookmark
+// "o0000000000desk", "001490898165086:2b2d7c4c..."
+// ============================================================================================================================
+func get_desk_audit(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var entries []DeskAuditEntry
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("desk_audit", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position := keyParts[1] + ":" + keyParts[2]              //tx time then tx id, sorts the same as the keys
+		if results.skip(position) {
+			continue
+		}
+		if results.full(position) {
+			break
+		}
+		var entry DeskAuditEntry
+		json.Unmarshal(queryResponse.Value, &entry)              //un stringify it aka JSON.parse()
+		entries = append(entries, entry)
+	}
+
+	return results.response(entries)
+}
+
+// ============================================================================================================================
+// Desk helpers
+// ============================================================================================================================
+func get_desk_doc(stub shim.ChaincodeStubInterface, desk_id string) (Desk, Owner, error) {
+	var desk Desk
+	owner, err := get_owner(stub, desk_id)
+	if err != nil {
+		return desk, owner, err
+	}
+	key, err := stub.CreateCompositeKey("desk", []string{desk_id})
+	if err != nil {
+		return desk, owner, err
+	}
+	deskAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return desk, owner, errors.New("Failed to get desk")
+	}
+	json.Unmarshal(deskAsBytes, &desk)                           //un stringify it aka JSON.parse()
+	if desk.Id != desk_id {                                      //test if desk is actually here or just nil
+		return desk, owner, errors.New("Desk does not exist - " + desk_id)
+	}
+	return desk, owner, nil
+}
+
+func put_desk(stub shim.ChaincodeStubInterface, desk Desk) error {
+	key, err := stub.CreateCompositeKey(desk.ObjectType, []string{desk.Id})
+	if err != nil {
+		return err
+	}
+	deskAsBytes, _ := json.Marshal(desk)                         //convert to array of bytes
+	return stub.PutState(key, deskAsBytes)
+}
@@ -0,0 +1,120 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Marble Diff Definitions - a field that differs between two versions of a marble, nested fields use dots ("owner.id")
+// ============================================================================================================================
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"` //null if the field wasn't there
+	After  interface{} `json:"after"`
+}
+
+// ============================================================================================================================
+// Diff Marble - compare the marble as tx A left it with the marble as tx B left it
+//
+// Shows off GetHistoryForKey() - both versions come from the history. A version from a delete is an empty marble.
+//
+// Inputs - Array of Strings
+//       0     ,       1      ,      2
+//  marble id  ,    tx id A   ,    tx id B
+// "m999999999", "2b2d7c4c...", "9f86d081..."
+// ============================================================================================================================
+func diff_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	marble_id := args[0]
+	versions := map[string]map[string]interface{}{}
+
+	resultsIterator, err := stub.GetHistoryForKey(marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if modification.TxId != args[1] && modification.TxId != args[2] {
+			continue
+		}
+		version := map[string]interface{}{}
+		if !modification.IsDelete {                              //a delete has no value
+			json.Unmarshal(modification.Value, &version)         //un stringify it aka JSON.parse()
+		}
+		versions[modification.TxId] = version
+	}
+	for _, txid := range args[1:] {
+		if _, found := versions[txid]; !found {
+			return shim.Error("Tx " + txid + " did not change marble " + marble_id)
+		}
+	}
+
+	changes := []FieldChange{}
+	diff_fields("", versions[args[1]], versions[args[2]], &changes)
+
+	fmt.Println("- diff_marble found " + fmt.Sprint(len(changes)) + " changes")
+	changesAsBytes, _ := json.Marshal(changes)                   //convert to array of bytes
+	return shim.Success(changesAsBytes)
+}
+
+// ============================================================================================================================
+// Marble Diff helpers
+// ============================================================================================================================
+
+// add every differing field to changes, in field name order, going into nested objects
+func diff_fields(prefix string, before map[string]interface{}, after map[string]interface{}, changes *[]FieldChange) {
+	fields := []string{}
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, found := before[field]; !found {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		name := prefix + field
+		beforeObject, beforeIsObject := before[field].(map[string]interface{})
+		afterObject, afterIsObject := after[field].(map[string]interface{})
+		if beforeIsObject && afterIsObject {
+			diff_fields(name + ".", beforeObject, afterObject, changes)
+			continue
+		}
+		beforeAsBytes, _ := json.Marshal(before[field])
+		afterAsBytes, _ := json.Marshal(after[field])
+		if string(beforeAsBytes) != string(afterAsBytes) {
+			*changes = append(*changes, FieldChange{Field: name, Before: before[field], After: after[field]})
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// State Digest Definitions - one hash over every document of a type, so orgs can check their peers agree
+//
+// Marbles and owners are plain keys, every other type lives under a composite key named after the type.
+// ============================================================================================================================
+type StateDigest struct {
+	DocType string `json:"docType"`
+	Count   int    `json:"count"`
+	Digest  string `json:"digest"` //sha256 hex
+}
+
+// ============================================================================================================================
+// State Digest - sha256 over the keys and values of every document of a type, in key order
+//
+// JSON values are hashed in a canonical form (keys sorted), CouchDB peers don't always give back the bytes that were put.
+//
+// Inputs - Array of Strings
+//      0
+//   doc type
+//   "marble"
+// ============================================================================================================================
+func state_digest(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var digest StateDigest
+	var resultsIterator shim.StateQueryIteratorInterface
+	var err error
+
+	digest.DocType = args[0]
+	plain_key := false
+
+	if digest.DocType == "marble" {
+		resultsIterator, err = stub.GetStateByRange("m0", "m9999999999999999999")
+		plain_key = true
+	} else if digest.DocType == "marble_owner" {
+		resultsIterator, err = stub.GetStateByRange("o0", "o9999999999999999999")
+		plain_key = true
+	} else {
+		resultsIterator, err = stub.GetStateByPartialCompositeKey(digest.DocType, []string{})
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	hash := sha256.New()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if plain_key && !has_doc_type(queryResponse.Value, digest.DocType) {
+			continue
+		}
+		hash.Write([]byte(queryResponse.Key))
+		hash.Write([]byte{0x00})                                 //separators so "ab"+"c" != "a"+"bc"
+		hash.Write(canonical_value(queryResponse.Value))
+		hash.Write([]byte{0x00})
+		digest.Count++
+	}
+	digest.Digest = hex.EncodeToString(hash.Sum(nil))
+
+	digestAsBytes, _ := json.Marshal(digest)                     //convert to array of bytes
+	return shim.Success(digestAsBytes)
+}
+
+// ============================================================================================================================
+// State Digest helpers
+// ============================================================================================================================
+func has_doc_type(value []byte, doc_type string) bool {
+	var doc struct {
+		ObjectType string `json:"docType"`
+	}
+	json.Unmarshal(value, &doc)                                  //un stringify it aka JSON.parse()
+	return doc.ObjectType == doc_type
+}
+
+// JSON re-marshalled with sorted keys, anything else as is (index entries, counters)
+func canonical_value(value []byte) []byte {
+	var parsed interface{}
+	err := json.Unmarshal(value, &parsed)
+	if err != nil {
+		return value
+	}
+	canonical, err := json.Marshal(parsed)
+	if err != nil {
+		return value
+	}
+	return canonical
+}
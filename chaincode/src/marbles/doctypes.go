@@ -0,0 +1,307 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Doc Type Definitions - extensions register their docType with a schema, then store docs with put_custom_doc()
+//
+// A registered doc is checked against its schema and stored under composite key docType + id, so state_digest() and
+// CouchDB queries on docType work for it like for the built in types. The built in types below keep their own code,
+// their names can't be registered. Index definitions are kept for tooling, CouchDB only builds the indexes that are
+// shipped in META-INF/statedb/couchdb/indexes with the chaincode.
+// ============================================================================================================================
+var builtin_doc_types = []string{
+	"activity", "badge", "beneficiary", "contact_info", "daily_limit", "daily_transfers", "delete_request", "desk",
+	"desk_audit", "doc_type", "document", "drop_claim", "flag_event", "holdings", "inspection_request", "invite",
+	"location", "marble", "marble_drop", "marble_owner", "marble_template", "mint_quota", "nonce", "operation", "op~owner",
+	"op~txid", "pool_claim", "rarity_count", "rarity~id", "receipt", "recipe", "reconciliation", "scheduled_transfer",
+	"serial", "serial_count", "tag", "username", "velocity", "warranty", "warranty_claim", "watcher", "watching",
+}
+
+var field_kinds = []string{"string", "number", "bool", "object", "array"}
+
+type DocType struct {
+	ObjectType string            `json:"docType"` //field for couchdb
+	Name       string            `json:"name"`
+	Fields     map[string]string `json:"fields"` //field -> kind, one of field_kinds
+	Required   []string          `json:"required,omitempty"`
+	Indexes    []json.RawMessage `json:"indexes,omitempty"`   //CouchDB index definitions
+	WriteRole  string            `json:"writeRole,omitempty"` //role that may put docs, admins only if empty
+}
+
+// ============================================================================================================================
+// Register Doc Type - add or replace a doc type's schema. Admin only
+//
+// Docs already stored are not checked again.
+//
+// Inputs - Array of Strings
+//       0      ,       1
+//    doc type  ,   definition json
+//   "lease"    , "{"fields":{"marbleId":"string","endsAt":"number"},"required":["marbleId"],"writeRole":"leasing"}"
+// ============================================================================================================================
+func register_doc_type(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var doc_type DocType
+	var err error
+	fmt.Println("starting register_doc_type")
+
+	// input sanitation, only the name, the definition is json
+	err = sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	name := args[0]
+	if contains(builtin_doc_types, name) || strings.HasPrefix(name, "_") {
+		return shim.Error("Doc type '" + name + "' is built in or reserved")
+	}
+	err = json.Unmarshal([]byte(args[1]), &doc_type)
+	if err != nil {
+		return shim.Error("Definition must be valid json")
+	}
+	if len(doc_type.Fields) == 0 {
+		return shim.Error("Definition needs at least one field")
+	}
+	for field, kind := range doc_type.Fields {
+		if field == "docType" || field == "id" {
+			return shim.Error("Fields docType and id are filled in by the chaincode")
+		}
+		if !contains(field_kinds, kind) {
+			return shim.Error("Field '" + field + "' kind must be one of " + strings.Join(field_kinds, ", "))
+		}
+	}
+	for _, field := range doc_type.Required {
+		if _, found := doc_type.Fields[field]; !found {
+			return shim.Error("Required field '" + field + "' is not in fields")
+		}
+	}
+
+	doc_type.ObjectType = "doc_type"
+	doc_type.Name = name
+	key, err := stub.CreateCompositeKey(doc_type.ObjectType, []string{doc_type.Name})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docTypeAsBytes, _ := json.Marshal(doc_type)                  //convert to array of bytes
+	err = stub.PutState(key, docTypeAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end register_doc_type")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Doc Types - read the built in doc type names and every registered doc type
+//
+// Inputs - none
+// ============================================================================================================================
+func get_doc_types(stub shim.ChaincodeStubInterface) pb.Response {
+	type DocTypes struct {
+		Builtin    []string  `json:"builtin"`
+		Registered []DocType `json:"registered"`
+	}
+	var doc_types DocTypes
+	doc_types.Builtin = builtin_doc_types
+	doc_types.Registered = []DocType{}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("doc_type", []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var doc_type DocType
+		json.Unmarshal(queryResponse.Value, &doc_type)           //un stringify it aka JSON.parse()
+		doc_types.Registered = append(doc_types.Registered, doc_type)
+	}
+
+	docTypesAsBytes, _ := json.Marshal(doc_types)                //convert to array of bytes
+	return shim.Success(docTypesAsBytes)
+}
+
+// ============================================================================================================================
+// Put Custom Doc - store a doc of a registered doc type, checked against its schema. Needs the doc type's write role
+//
+// Inputs - Array of Strings
+//       0     ,      1     ,           2
+//    doc type ,   doc id   ,        doc json
+//    "lease"  , "l99999999", "{"marbleId":"m999999999","endsAt":1490898165086}"
+// ============================================================================================================================
+func put_custom_doc(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var doc map[string]interface{}
+	var err error
+	fmt.Println("starting put_custom_doc")
+
+	// input sanitation, only the type and id, the doc is json
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	doc_type, err := get_doc_type(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(doc_type.WriteRole) > 0 {
+		err = check_role(stub, doc_type.WriteRole)
+	} else {
+		err = check_admin(stub)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = json.Unmarshal([]byte(args[2]), &doc)
+	if err != nil || doc == nil {
+		return shim.Error("Doc must be a json object")
+	}
+	err = check_doc(doc_type, doc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	doc["docType"] = doc_type.Name
+	doc["id"] = args[1]
+	key, err := stub.CreateCompositeKey(doc_type.Name, []string{args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docAsBytes, _ := json.Marshal(doc)                           //convert to array of bytes, map keys come out sorted
+	err = stub.PutState(key, docAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end put_custom_doc")
+	return shim.Success(docAsBytes)
+}
+
+// ============================================================================================================================
+// Get Custom Doc - read a doc of a registered doc type
+//
+// Inputs - Array of Strings
+//       0     ,      1
+//    doc type ,   doc id
+//    "lease"  , "l99999999"
+// ============================================================================================================================
+func get_custom_doc(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	doc_type, err := get_doc_type(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(doc_type.Name, []string{args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get doc")
+	}
+	if docAsBytes == nil {
+		return shim.Error("Doc does not exist - " + args[0] + " " + args[1])
+	}
+	return shim.Success(docAsBytes)
+}
+
+// ============================================================================================================================
+// Doc Type helpers
+// ============================================================================================================================
+func get_doc_type(stub shim.ChaincodeStubInterface, name string) (DocType, error) {
+	var doc_type DocType
+	key, err := stub.CreateCompositeKey("doc_type", []string{name})
+	if err != nil {
+		return doc_type, err
+	}
+	docTypeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return doc_type, errors.New("Failed to get doc type")
+	}
+	json.Unmarshal(docTypeAsBytes, &doc_type)                    //un stringify it aka JSON.parse()
+	if doc_type.Name != name {                                   //test if doc type is actually here or just nil
+		return doc_type, errors.New("Doc type is not registered - " + name)
+	}
+	return doc_type, nil
+}
+
+// every field must be in the schema with the right kind, and every required field must be there
+func check_doc(doc_type DocType, doc map[string]interface{}) error {
+	fields := []string{}
+	for field := range doc {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)                                         //so the error is the same on every peer
+	for _, field := range fields {
+		if field == "docType" || field == "id" {
+			continue                                             //filled in for them
+		}
+		kind, found := doc_type.Fields[field]
+		if !found {
+			return errors.New("Field '" + field + "' is not in the " + doc_type.Name + " schema")
+		}
+		if kind_of(doc[field]) != kind {
+			return errors.New("Field '" + field + "' must be " + kind + ", got " + kind_of(doc[field]))
+		}
+	}
+	for _, field := range doc_type.Required {
+		if _, found := doc[field]; !found {
+			return errors.New("Field '" + field + "' is required for " + doc_type.Name)
+		}
+	}
+	return nil
+}
+
+func kind_of(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "null"
+}
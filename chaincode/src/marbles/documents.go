@@ -0,0 +1,134 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Notarized Documents ----- //
+type NotarizedDocument struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	MarbleId    string `json:"marbleId"`
+	DocHash     string `json:"docHash"` //hash of the off chain document, the document itself never hits the ledger
+	Description string `json:"description"`
+	NotarizedBy string `json:"notarizedBy"` //invoker id
+	NotarizedAt int64  `json:"notarizedAt"` //ms, tx time
+	TxId        string `json:"txId"`
+}
+
+// ============================================================================================================================
+// Notarize Document - time stamp a document hash against a marble
+//
+// Inputs - Array of Strings
+//       0     ,        1       ,       2
+//  marble id  ,  document hash ,  description
+// "m999999999", "9f86d081884c7d...", "lab report"
+// ============================================================================================================================
+func notarize_document(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting notarize_document")
+
+	// input sanitation, hashes can be longer than the usual limit
+	err = sanitize_arguments([]string{args[0], args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 || len(args[1]) > 128 {
+		return shim.Error("Argument 1 must be a non-empty string <= 128 characters")
+	}
+
+	marble_id := args[0]
+	doc_hash := args[1]
+	description := args[2]
+
+	_, err = get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("document", []string{marble_id, doc_hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existingAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get document")
+	}
+	if existingAsBytes != nil {                                  //keep the original time stamp, that's the point
+		return shim.Error("This document is already notarized for " + marble_id)
+	}
+
+	var doc NotarizedDocument
+	doc.ObjectType = "document"
+	doc.MarbleId = marble_id
+	doc.DocHash = doc_hash
+	doc.Description = description
+	doc.TxId = stub.GetTxID()
+	doc.NotarizedBy, err = get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	doc.NotarizedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	docAsBytes, _ := json.Marshal(doc)                           //convert to array of bytes
+	err = stub.PutState(key, docAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end notarize_document")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Verify Document - get the notarization record of a document hash, errors if it was never notarized
+//
+// Inputs - Array of Strings
+//       0     ,        1
+//  marble id  ,  document hash
+// "m999999999", "9f86d081884c7d..."
+// ============================================================================================================================
+func verify_document(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	marble_id := args[0]
+	doc_hash := args[1]
+
+	key, err := stub.CreateCompositeKey("document", []string{marble_id, doc_hash})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	docAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get document")
+	}
+	if docAsBytes == nil {
+		return shim.Error("Document was not notarized for " + marble_id)
+	}
+
+	return shim.Success(docAsBytes)
+}
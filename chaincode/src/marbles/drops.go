@@ -0,0 +1,258 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Drop Definitions - a set number of marbles from a template, held back until a start time
+//
+// The marbles are earmarked, not minted up front. Each claim_drop() mints one, after the start time, until none are left.
+// Minting them all in create_drop() would go wrong - GetState() doesn't see writes from the same transaction, so the
+// holdings, rarity and mint quota counters would only go up by one for the whole drop.
+// ============================================================================================================================
+const MAX_DROP_SIZE = 10000
+
+type Drop struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	Id         string `json:"id"`
+	TemplateId string `json:"templateId"`
+	Count      int    `json:"count"`
+	Remaining  int    `json:"remaining"`
+	StartMs    int64  `json:"startMs"`   //no claims before this, tx time
+	CreatedBy  string `json:"createdBy"` //invoker id, see get_invoker()
+}
+
+// ============================================================================================================================
+// Create Drop - earmark marbles from a template for a scheduled launch. Admin only
+//
+// The drop id is the first 16 characters of this tx id, it is returned in the drop.
+//
+// Inputs - Array of Strings
+//       0     ,   1   ,        2
+//  template id, count ,  start time ms
+//   "classic" , "100" , "1490898165086"
+// ============================================================================================================================
+func create_drop(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var drop Drop
+	var err error
+	fmt.Println("starting create_drop")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	template, err := get_template_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	drop.Count, err = strconv.Atoi(args[1])
+	if err != nil || drop.Count <= 0 || drop.Count > MAX_DROP_SIZE {
+		return shim.Error("2nd argument must be a numeric string from 1 to " + strconv.Itoa(MAX_DROP_SIZE))
+	}
+	drop.StartMs, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil || drop.StartMs < 0 {
+		return shim.Error("3rd argument must be a non-negative numeric string")
+	}
+
+	drop.ObjectType = "marble_drop"
+	drop.Id = stub.GetTxID()
+	if len(drop.Id) > 16 {
+		drop.Id = drop.Id[:16]
+	}
+	drop.TemplateId = template.Id
+	drop.Remaining = drop.Count
+	drop.CreatedBy, err = get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_drop(stub, drop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end create_drop")
+	dropAsBytes, _ := json.Marshal(drop)                         //send back the drop, the client needs its id
+	return shim.Success(dropAsBytes)
+}
+
+// ============================================================================================================================
+// Claim Drop - mint one of a drop's marbles for an owner, once the drop has started. One per owner per drop
+//
+// Inputs - Array of Strings
+//          0        ,      1      ,        2        ,         3
+//       drop id     ,  marble id  ,     owner id    ,  authing company
+//  "2b2d7c4c1f0e9a8b", "m999999999", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func claim_drop(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting claim_drop")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	drop_id := args[0]
+	marble_id := args[1]
+	owner_id := args[2]
+	authed_by_company := args[3]
+
+	drop, err := get_drop_doc(stub, drop_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now < drop.StartMs {
+		return shim.Error("Drop " + drop_id + " does not start until " + strconv.FormatInt(drop.StartMs, 10))
+	}
+	if drop.Remaining <= 0 {
+		return shim.Error("Drop " + drop_id + " has no marbles left")
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize claims for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can claim for it
+	err = check_owner_identity(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// one each
+	claimKey, err := stub.CreateCompositeKey("drop_claim", []string{drop_id, owner_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimAsBytes, err := stub.GetState(claimKey)
+	if err != nil {
+		return shim.Error("Failed to get drop claim")
+	}
+	if claimAsBytes != nil {
+		return shim.Error("Owner already claimed from drop " + drop_id + " - " + string(claimAsBytes))
+	}
+	err = stub.PutState(claimKey, []byte(marble_id))             //remember which marble they got
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	template, err := get_template_doc(stub, drop.TemplateId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var marble Marble
+	marble.Id = marble_id
+	marble.Color = template.Color
+	marble.Size = template.Size
+	marble.Rarity = template.Rarity
+	marble.TemplateId = template.Id
+	marble.Attributes = template.Attributes
+	marble.DropId = drop.Id
+	marble.Owner.Id = owner.Id
+	marble.Owner.Username = owner.Username
+	marble.Owner.Company = owner.Company
+	err = create_marble(stub, &marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	drop.Remaining--
+	err = put_drop(stub, drop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end claim_drop")
+	marbleAsBytes, _ := json.Marshal(marble)                     //send back the marble as stored, saves the client a query
+	return shim.Success(marbleAsBytes)
+}
+
+// ============================================================================================================================
+// Get Drop - read a drop, including how many marbles are left
+//
+// Inputs - Array of Strings
+//          0
+//       drop id
+//  "2b2d7c4c1f0e9a8b"
+// ============================================================================================================================
+func get_drop(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	drop, err := get_drop_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dropAsBytes, _ := json.Marshal(drop)                         //convert to array of bytes
+	return shim.Success(dropAsBytes)
+}
+
+// ============================================================================================================================
+// Drop helpers
+// ============================================================================================================================
+func get_drop_doc(stub shim.ChaincodeStubInterface, drop_id string) (Drop, error) {
+	var drop Drop
+	key, err := stub.CreateCompositeKey("marble_drop", []string{drop_id})
+	if err != nil {
+		return drop, err
+	}
+	dropAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return drop, errors.New("Failed to get drop")
+	}
+	json.Unmarshal(dropAsBytes, &drop)                           //un stringify it aka JSON.parse()
+	if drop.Id != drop_id {                                      //test if drop is actually here or just nil
+		return drop, errors.New("Drop does not exist - " + drop_id)
+	}
+	return drop, nil
+}
+
+func put_drop(stub shim.ChaincodeStubInterface, drop Drop) error {
+	key, err := stub.CreateCompositeKey(drop.ObjectType, []string{drop.Id})
+	if err != nil {
+		return err
+	}
+	dropAsBytes, _ := json.Marshal(drop)                         //convert to array of bytes
+	return stub.PutState(key, dropAsBytes)
+}
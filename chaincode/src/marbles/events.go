@@ -0,0 +1,78 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Event Definitions - chaincode events for marble lifecycle changes, so clients can listen instead of polling
+//
+// Names are "marble_created", "owner_changed" and "marble_deleted", the payload is a MarbleEvent.
+// Fabric keeps one event per transaction, so handlers' SetEvent() calls are collected by the op_recorder and sent once
+// the handler succeeds. A transaction with one event sends it as is, one with more (crafting, an inheritance claim, a
+// watched marble) sends a "marble_events" event whose payload is a list of {name, payload}.
+// ============================================================================================================================
+const BATCH_EVENT_NAME = "marble_events"
+
+type MarbleEvent struct {
+	MarbleId   string `json:"marbleId"`
+	Color      string `json:"color"`
+	Size       int    `json:"size"`
+	OldOwnerId string `json:"oldOwnerId,omitempty"`
+	NewOwnerId string `json:"newOwnerId,omitempty"`
+	TxId       string `json:"txId"`
+}
+
+type ChaincodeEvent struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ============================================================================================================================
+// Event helpers
+// ============================================================================================================================
+func emit_marble_event(stub shim.ChaincodeStubInterface, name string, marble Marble, old_owner_id string, new_owner_id string) error {
+	var event MarbleEvent
+	event.MarbleId = marble.Id
+	event.Color = marble.Color
+	event.Size = marble.Size
+	event.OldOwnerId = old_owner_id
+	event.NewOwnerId = new_owner_id
+	event.TxId = stub.GetTxID()
+	eventAsBytes, _ := json.Marshal(event)                       //convert to array of bytes
+	return stub.SetEvent(name, eventAsBytes)
+}
+
+// send what the handler emitted, called after a successful dispatch
+func flush_events(stub shim.ChaincodeStubInterface, recorder *op_recorder) error {
+	if len(recorder.events) == 0 {
+		return nil
+	}
+	if len(recorder.events) == 1 {
+		return stub.SetEvent(recorder.events[0].Name, recorder.events[0].Payload)
+	}
+	eventsAsBytes, _ := json.Marshal(recorder.events)            //convert to array of bytes
+	return stub.SetEvent(BATCH_EVENT_NAME, eventsAsBytes)
+}
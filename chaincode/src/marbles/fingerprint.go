@@ -0,0 +1,139 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Fingerprint Definitions - a hash of a marble's physical attributes, so one physical marble can't be on the ledger twice
+//
+// The canonical form is the color, the weight in grams and the dimensions in mm smallest first (so a marble measured
+// on its side still matches), each rounded to a whole number of steps a scale/caliper can tell apart. Marbles without
+// physical data (see set_physical() and init_marble()) have no fingerprint. The index is composite key "fp~hash" + hash,
+// its value is the marble id.
+// ============================================================================================================================
+const FINGERPRINT_INDEX = "fp~hash"
+const WEIGHT_STEPS_PER_GRAM = 100                                //0.01 g
+const LENGTH_STEPS_PER_MM = 10                                   //0.1 mm
+
+// ============================================================================================================================
+// Get Marble By Fingerprint - read the marble with a fingerprint, to check a marble before it's entered
+//
+// Inputs - Array of Strings
+//      0
+//  fingerprint
+//  "9f86d081..."
+// ============================================================================================================================
+func get_marble_by_fingerprint(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	indexKey, err := stub.CreateCompositeKey(FINGERPRINT_INDEX, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	idAsBytes, err := stub.GetState(indexKey)
+	if err != nil {
+		return shim.Error("Failed to get fingerprint index")
+	}
+	if idAsBytes == nil {
+		return shim.Error("No marble has fingerprint " + args[0])
+	}
+
+	marbleAsBytes, err := stub.GetState(string(idAsBytes))
+	if err != nil {
+		return shim.Error("Failed to get marble")
+	}
+	return shim.Success(marbleAsBytes)
+}
+
+// ============================================================================================================================
+// Fingerprint helpers
+// ============================================================================================================================
+
+// empty if the marble has no physical data
+func marble_fingerprint(marble Marble) string {
+	if marble.Physical == nil {
+		return ""
+	}
+	factor := length_units[marble.Physical.LengthUnit]
+	steps := factor * LENGTH_STEPS_PER_MM
+	dims := []int{quantize(marble.Physical.Length, steps), quantize(marble.Physical.Width, steps), quantize(marble.Physical.Height, steps)}
+	sort.Ints(dims)
+	weight := quantize(marble.Physical.WeightGrams, WEIGHT_STEPS_PER_GRAM)
+	canonical := marble.Color + "|" + strconv.Itoa(weight) + "|" + strconv.Itoa(dims[0]) + "x" + strconv.Itoa(dims[1]) + "x" + strconv.Itoa(dims[2])
+	fingerprintHash := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(fingerprintHash[:])
+}
+
+// the value in whole steps, rounded half away from zero
+func quantize(value float64, steps_per_unit float64) int {
+	return int(math.Round(value * steps_per_unit))
+}
+
+// set the marble's fingerprint from its physical data and take the index entry, errors if another marble has it
+func claim_fingerprint(stub shim.ChaincodeStubInterface, marble *Marble) error {
+	fingerprint := marble_fingerprint(*marble)
+	if fingerprint == marble.Fingerprint {                       //nothing that counts changed
+		return nil
+	}
+	if len(fingerprint) > 0 {
+		indexKey, err := stub.CreateCompositeKey(FINGERPRINT_INDEX, []string{fingerprint})
+		if err != nil {
+			return err
+		}
+		idAsBytes, err := stub.GetState(indexKey)
+		if err != nil {
+			return errors.New("Failed to get fingerprint index")
+		}
+		if idAsBytes != nil && string(idAsBytes) != marble.Id {
+			return errors.New("Marble '" + string(idAsBytes) + "' has the same physical attributes, fingerprint " + fingerprint)
+		}
+		err = stub.PutState(indexKey, []byte(marble.Id))
+		if err != nil {
+			return err
+		}
+	}
+	err := release_fingerprint(stub, *marble)                    //the old one is free for someone else now
+	if err != nil {
+		return err
+	}
+	marble.Fingerprint = fingerprint
+	return nil
+}
+
+func release_fingerprint(stub shim.ChaincodeStubInterface, marble Marble) error {
+	if len(marble.Fingerprint) == 0 {
+		return nil
+	}
+	indexKey, err := stub.CreateCompositeKey(FINGERPRINT_INDEX, []string{marble.Fingerprint})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
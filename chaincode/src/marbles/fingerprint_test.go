@@ -0,0 +1,46 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+func TestFingerprintClaimedAtMint(t *testing.T) {
+	stub, _, alice, _ := new_identity_fixture(t)
+
+	marble := stub.must(t, alice, "init_marble", "m2", "blue", "35", "o1", COMPANY, "common", "5.2", "g", "16", "16", "16", "mm")
+	if len(marble.Payload) == 0 || len(stub.marble(t, "m2").Fingerprint) == 0 {
+		t.Fatal("m2 should have a fingerprint from its physical data")
+	}
+	stub.must_fail(t, alice, "init_marble", "m3", "blue", "35", "o1", COMPANY, "common", "5.2", "g", "1.6", "1.6", "1.6", "cm")
+	stub.must(t, alice, "init_marble", "m3", "blue", "35", "o1", COMPANY, "common", "5.3", "g", "16", "16", "16", "mm")
+	stub.must_fail(t, alice, "set_physical", "m1", "5.2", "g", "16", "16", "16", "mm", COMPANY)
+}
+
+func TestFingerprintRoundsHalfUp(t *testing.T) {
+	stub, _, alice, _ := new_identity_fixture(t)
+
+	// 5.125 g is 512.5 steps, it has to land on the same step as 5.13 g
+	stub.must(t, alice, "set_physical", "m1", "5.125", "g", "16", "16", "16", "mm", COMPANY)
+	stub.must(t, alice, "init_marble", "m2", "blue", "35", "o1", COMPANY)
+	stub.must_fail(t, alice, "set_physical", "m2", "5.13", "g", "16", "16", "16", "mm", COMPANY)
+}
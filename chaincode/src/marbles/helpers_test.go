@@ -0,0 +1,284 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Test Stub - a MockStub that acts more like a peer
+//
+// MockStub has no creator, and its GetState() sees the transaction's own writes. Here each call runs as an enrolled
+// identity, writes are held until the transaction succeeds, and reads only see committed state like on a real peer.
+// ============================================================================================================================
+type test_stub struct {
+	*shim.MockStub
+	cc        *SimpleChaincode
+	creator   []byte
+	args      [][]byte
+	writes    map[string][]byte  //nil value is a delete
+	private   map[string][]byte  //same for the contact collection, the only one there is
+	transient map[string][]byte  //transient map of the next transaction
+	event     *pb.ChaincodeEvent //the one event the last transaction sent
+	scans     []string           //object types the last transaction scanned by partial key
+	now       int64              //ms, tx time of the next transaction
+	txs       int
+	bulk      bool            //commit straight to State, skipping MockStub's sorted key list. see sort_keys()
+	index     []*list.Element //the sorted key list as of sort_keys(), so bulk scans can seek like a peer does
+}
+
+func new_test_stub(t testing.TB) (*test_stub, []byte) {
+	cc := new(SimpleChaincode)
+	stub := &test_stub{MockStub: shim.NewMockStub("marbles", cc), cc: cc, now: 1490898165086}
+	admin := new_identity(t, "Org1MSP", "admin")
+	stub.creator = admin
+	stub.args = [][]byte{[]byte("init"), []byte("1")}
+	stub.start()
+	response := cc.Init(stub)
+	stub.end(response)
+	if response.Status != shim.OK {
+		t.Fatalf("init failed - %s", response.Message)
+	}
+	return stub, admin
+}
+
+// an enrolled identity, serialized the way the peer hands it to chaincode
+func new_identity(t testing.TB, mspid string, name string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{mspid}},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(4102444800, 0),
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := &msp.SerializedIdentity{Mspid: mspid, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes})}
+	identityAsBytes, err := proto.Marshal(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identityAsBytes
+}
+
+// run a function as an identity, the writes are committed if it succeeds
+func (s *test_stub) invoke(creator []byte, function string, args ...string) pb.Response {
+	s.creator = creator
+	s.args = [][]byte{[]byte(function)}
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.start()
+	response := s.cc.Invoke(s)
+	s.end(response)
+	return response
+}
+
+func (s *test_stub) must(t testing.TB, creator []byte, function string, args ...string) pb.Response {
+	t.Helper()
+	response := s.invoke(creator, function, args...)
+	if response.Status != shim.OK {
+		t.Fatalf("%s%v failed - %s", function, args, response.Message)
+	}
+	return response
+}
+
+func (s *test_stub) must_fail(t testing.TB, creator []byte, function string, args ...string) pb.Response {
+	t.Helper()
+	response := s.invoke(creator, function, args...)
+	if response.Status == shim.OK {
+		t.Fatalf("%s%v should have failed", function, args)
+	}
+	return response
+}
+
+func (s *test_stub) start() {
+	s.txs++
+	s.MockTransactionStart("tx" + strconv.Itoa(s.txs))
+	s.TxTimestamp = &timestamp.Timestamp{Seconds: s.now / 1000, Nanos: int32(s.now % 1000) * 1000000}
+	s.writes = map[string][]byte{}
+	s.private = map[string][]byte{}
+	s.event = nil
+	s.scans = nil
+}
+
+func (s *test_stub) end(response pb.Response) {
+	if response.Status == shim.OK {
+		keys := []string{}
+		for key := range s.writes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if s.bulk {
+				if s.writes[key] == nil {
+					delete(s.State, key)
+				} else {
+					s.State[key] = s.writes[key]
+				}
+			} else if s.writes[key] == nil {
+				s.MockStub.DelState(key)
+			} else {
+				s.MockStub.PutState(key, s.writes[key])
+			}
+		}
+		for key, value := range s.private {
+			if value == nil {
+				delete(s.PvtState[CONTACT_COLLECTION], key)
+			} else {
+				s.MockStub.PutPrivateData(CONTACT_COLLECTION, key, value)
+			}
+		}
+	} else {
+		s.event = nil
+	}
+	s.MockTransactionEnd(s.TxID)
+}
+
+// rebuild MockStub's sorted key list after bulk commits, scans don't see bulk keys until then
+func (s *test_stub) sort_keys() {
+	keys := []string{}
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s.Keys.Init()
+	s.index = nil
+	for _, key := range keys {
+		s.index = append(s.index, s.Keys.PushBack(key))
+	}
+}
+
+func (s *test_stub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *test_stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *test_stub) GetStringArgs() []string {
+	strs := []string{}
+	for _, arg := range s.args {
+		strs = append(strs, string(arg))
+	}
+	return strs
+}
+
+func (s *test_stub) GetFunctionAndParameters() (string, []string) {
+	strs := s.GetStringArgs()
+	return strs[0], strs[1:]
+}
+
+func (s *test_stub) PutState(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	s.writes[key] = value
+	return nil
+}
+
+func (s *test_stub) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+func (s *test_stub) PutPrivateData(collection string, key string, value []byte) error {
+	s.private[key] = value
+	return nil
+}
+
+func (s *test_stub) DelPrivateData(collection string, key string) error {
+	s.private[key] = nil
+	return nil
+}
+
+func (s *test_stub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *test_stub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	s.scans = append(s.scans, objectType)
+	if !s.bulk {
+		return s.MockStub.GetStateByPartialCompositeKey(objectType, attributes)
+	}
+	startKey, err := s.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	iterator := &shim.MockStateRangeQueryIterator{Stub: s.MockStub, StartKey: startKey, EndKey: startKey + string(utf8.MaxRune)}
+	i := sort.Search(len(s.index), func(i int) bool { return s.index[i].Value.(string) >= startKey })
+	if i == len(s.index) {
+		i--                                                      //nothing at or after it, the last key ends the scan
+	}
+	if i >= 0 {
+		iterator.Current = s.index[i]                            //MockStub starts every scan at the front
+	}
+	return iterator, nil
+}
+
+func (s *test_stub) SetEvent(name string, payload []byte) error {
+	s.event = &pb.ChaincodeEvent{EventName: name, Payload: payload}  //the peer keeps the last one
+	return nil
+}
+
+// ============================================================================================================================
+// Fixtures
+// ============================================================================================================================
+func (s *test_stub) marble(t testing.TB, id string) Marble {
+	t.Helper()
+	var marble Marble
+	json.Unmarshal(s.State[id], &marble)
+	if marble.Id != id {
+		t.Fatalf("marble %s does not exist", id)
+	}
+	return marble
+}
+
+func (s *test_stub) holdings(owner_id string) string {
+	key, _ := s.CreateCompositeKey("holdings", []string{owner_id})
+	return string(s.State[key])
+}
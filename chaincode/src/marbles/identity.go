@@ -0,0 +1,146 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Identity Definitions - an owner is controlled by the enrolled identity that created it
+//
+// The fingerprint is the msp id plus a hash of the client identity library's id (the cert's subject and issuer),
+// so unlike get_invoker() it survives the cert being reissued.
+// Every handler that moves or destroys an owner's marbles, or sets up something that will later (a schedule, a beneficiary,
+// a desk member, a signing key...), only takes calls from that owner's identity or an admin. Edits that leave the marble
+// where it is (tags, metadata, physical data) still only check the company. Owners with no identity (bulk loaded, purged)
+// can only be acted for by an admin until one binds an identity.
+// ============================================================================================================================
+
+// ============================================================================================================================
+// Get Identity - return the identity fingerprint of the caller, this is the id to hand to set_owner_identity
+//
+// Inputs - none
+// ============================================================================================================================
+func get_identity(stub shim.ChaincodeStubInterface) pb.Response {
+	identity, err := get_identity_fingerprint(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(identity))
+}
+
+// ============================================================================================================================
+// Set Owner Identity - bind an owner to an identity fingerprint, for owners without one or a lost enrollment. Admin only
+//
+// Inputs - Array of Strings
+//          0       ,         1
+//      owner id    ,  identity (see get_identity)
+// "o9999999999999" , "Org1MSP.5e1c..."
+// ============================================================================================================================
+func set_owner_identity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_owner_identity")
+
+	// the identity has a 64 char hash in it, so only the owner id gets the usual check
+	err := sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 {
+		return shim.Error("Argument 1 must be a non-empty string")
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner, err := get_owner(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner.Identity = args[1]
+	err = put_owner(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_owner_identity")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Identity helpers
+// ============================================================================================================================
+func get_identity_fingerprint(stub shim.ChaincodeStubInterface) (string, error) {
+	mspid, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", errors.New("Failed to get msp id of transaction")
+	}
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "", errors.New("Failed to get client id of transaction")
+	}
+	idHash := sha256.Sum256([]byte(id))
+	return mspid + "." + hex.EncodeToString(idHash[:]), nil
+}
+
+// error unless the caller is the owner's identity or an admin
+func check_owner_identity(stub shim.ChaincodeStubInterface, owner_id string) error {
+	if check_admin(stub) == nil {
+		return nil
+	}
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return err
+	}
+	if len(owner.Identity) == 0 {
+		return errors.New("Owner '" + owner_id + "' has no identity, an admin has to act for it or bind one with set_owner_identity")
+	}
+	identity, err := get_identity_fingerprint(stub)
+	if err != nil {
+		return err
+	}
+	if identity != owner.Identity {
+		return errors.New("The identity '" + identity + "' does not control owner '" + owner_id + "'")
+	}
+	return nil
+}
+
+// true if the invoker is the owner's identity, admins don't count
+func is_owner_identity(stub shim.ChaincodeStubInterface, owner_id string) (bool, error) {
+	owner, err := get_owner(stub, owner_id)
+	if err != nil || len(owner.Identity) == 0 {
+		return false, nil                                        //a gone or unbound owner can't be the invoker
+	}
+	identity, err := get_identity_fingerprint(stub)
+	if err != nil {
+		return false, err
+	}
+	return identity == owner.Identity, nil
+}
@@ -0,0 +1,166 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const COMPANY = "united marbles"
+
+// alice owns o1 and marble m1, mallory owns o2 and is at the same company
+func new_identity_fixture(t *testing.T) (*test_stub, []byte, []byte, []byte) {
+	stub, admin := new_test_stub(t)
+	alice := new_identity(t, "Org1MSP", "alice")
+	mallory := new_identity(t, "Org1MSP", "mallory")
+	stub.must(t, alice, "init_owner", "o1", "alice", COMPANY)
+	stub.must(t, mallory, "init_owner", "o2", "mallory", COMPANY)
+	stub.must(t, alice, "init_marble", "m1", "blue", "35", "o1", COMPANY)
+	return stub, admin, alice, mallory
+}
+
+func public_key_pem(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAsBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyAsBytes}))
+}
+
+func TestAcceptsOwnerIdentityAndAdmin(t *testing.T) {
+	stub, admin, alice, _ := new_identity_fixture(t)
+
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o2" {
+		t.Fatal("marble should belong to o2")
+	}
+	stub.must(t, admin, "set_owner", "m1", "o1", COMPANY)        //admins can act for anyone
+	if stub.marble(t, "m1").Owner.Id != "o1" {
+		t.Fatal("marble should be back with o1")
+	}
+}
+
+func TestRejectsForeignIdentity(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(stub *test_stub, admin []byte, alice []byte)
+		fn    string
+		args  []string
+	}{
+		{"set_owner", nil, "set_owner", []string{"m1", "o2", COMPANY}},
+		{"delete_marble", nil, "delete_marble", []string{"m1", COMPANY}},
+		{"release_to_pool", nil, "release_to_pool", []string{"m1", COMPANY}},
+		{"claim_from_pool", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "release_to_pool", "m1", COMPANY)
+		}, "claim_from_pool", []string{"m1", "o1", COMPANY}},
+		{"schedule_transfer", nil, "schedule_transfer", []string{"m1", "o2", "0", COMPANY}},
+		{"craft", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, admin, "set_recipe", "big_red", `{"inputs":[{"color":"blue","size":35,"count":1}],"output":{"color":"red","size":35}}`)
+		}, "craft", []string{"big_red", "m9", COMPANY, "m1"}},
+		{"add_desk_member", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "create_desk", "d1", "fx desk", COMPANY)
+		}, "add_desk_member", []string{"d1", "o2", COMPANY}},
+		{"desk_transfer", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "create_desk", "d1", "fx desk", COMPANY)
+			stub.must(t, alice, "add_desk_member", "d1", "o1", COMPANY)
+			stub.must(t, alice, "set_owner", "m1", "d1", COMPANY)
+		}, "desk_transfer", []string{"m1", "o2", "o1", COMPANY}},
+		{"register_public_key", nil, "register_public_key", []string{"o1", public_key_pem(t), COMPANY}},
+		{"set_nonce_required", nil, "set_nonce_required", []string{"o1", "false", COMPANY}},
+		{"set_beneficiary", nil, "set_beneficiary", []string{"o1", "o2", "31536000000", COMPANY}},
+		{"claim_inheritance", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "init_owner", "o3", "heir", COMPANY)
+			stub.must(t, alice, "set_beneficiary", "o1", "o3", "31536000000", COMPANY)
+			stub.now += 31536000000 + 1
+		}, "claim_inheritance", []string{"o1", "o3", COMPANY}},
+		{"set_protected", nil, "set_protected", []string{"m1", "true", COMPANY}},
+		{"request_delete", nil, "request_delete", []string{"m1", COMPANY}},
+		{"split_ownership", nil, "split_ownership", []string{"m1", "51", COMPANY}},
+		{"transfer_shares", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "split_ownership", "m1", "51", COMPANY)
+		}, "transfer_shares", []string{"m1", "o1", "o2", "100", COMPANY}},
+		{"approve_transfer", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, alice, "split_ownership", "m1", "51", COMPANY)
+		}, "approve_transfer", []string{"m1", "o2", "o1", COMPANY}},
+		{"transition", func(stub *test_stub, admin []byte, alice []byte) {
+			stub.must(t, admin, "transition", "m1", "inspected")
+		}, "transition", []string{"m1", "listed"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stub, admin, alice, mallory := new_identity_fixture(t)
+			if c.setup != nil {
+				c.setup(stub, admin, alice)
+			}
+			response := stub.must_fail(t, mallory, c.fn, c.args...)
+			if !strings.Contains(response.Message, "does not control owner") {
+				t.Fatalf("%s failed for the wrong reason - %s", c.fn, response.Message)
+			}
+		})
+	}
+}
+
+func TestOwnerWithoutIdentityNeedsAdmin(t *testing.T) {
+	stub, admin, _, mallory := new_identity_fixture(t)
+	stub.must(t, admin, "init_owners_bulk", `[{"id":"o4","username":"bulk","company":"`+COMPANY+`"}]`)
+	stub.must(t, admin, "set_owner", "m1", "o4", COMPANY)
+
+	response := stub.must_fail(t, mallory, "set_owner", "m1", "o2", COMPANY)
+	if !strings.Contains(response.Message, "has no identity") {
+		t.Fatalf("wrong error - %s", response.Message)
+	}
+
+	// bind mallory's identity, now she can
+	identity := string(stub.must(t, mallory, "get_identity").Payload)
+	stub.must_fail(t, mallory, "set_owner_identity", "o4", identity)  //admin only
+	stub.must(t, admin, "set_owner_identity", "o4", identity)
+	stub.must(t, mallory, "set_owner", "m1", "o2", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o2" {
+		t.Fatal("marble should belong to o2")
+	}
+}
+
+func TestIdentitySurvivesCertReissue(t *testing.T) {
+	stub, _ := new_test_stub(t)
+	first := new_identity(t, "Org1MSP", "alice")
+	second := new_identity(t, "Org1MSP", "alice")                 //new key, same subject and issuer
+	a := stub.must(t, first, "get_identity").Payload
+	b := stub.must(t, second, "get_identity").Payload
+	if string(a) != string(b) {
+		t.Fatalf("fingerprints differ - %s, %s", a, b)
+	}
+	if stub.invoke(first, "whoami").Status != shim.OK {
+		t.Fatal("whoami failed")
+	}
+}
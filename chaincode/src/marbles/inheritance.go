@@ -0,0 +1,337 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const MIN_INACTIVITY_MS = 30 * 24 * 60 * 60 * 1000               //a month, any shorter and a holiday could cost an owner their marbles
+
+// ============================================================================================================================
+// Inheritance Definitions - a beneficiary can take over an owner's marbles once the owner goes quiet for long enough
+//
+// The owner counts as active when they name a beneficiary, check in, or transfer a marble away. Receiving marbles doesn't count.
+// The inactivity period can't be shorter than MIN_INACTIVITY_MS.
+// ============================================================================================================================
+type Beneficiary struct {
+	ObjectType    string `json:"docType"` //field for couchdb
+	OwnerId       string `json:"ownerId"`
+	BeneficiaryId string `json:"beneficiaryId"`
+	InactivityMs  int64  `json:"inactivityMs"`
+	LastActiveMs  int64  `json:"lastActiveMs"` //tx time
+}
+
+// ============================================================================================================================
+// Set Beneficiary - name who gets an owner's marbles if the owner is inactive for a while
+//
+// Inputs - Array of Strings
+//           0     ,        1        ,       2       ,         3
+//      owner id   ,  beneficiary id ,  inactivity ms,  authing company
+// "o9999999999999", "o8888888888888", "31536000000" , "united marbles"
+// ============================================================================================================================
+func set_beneficiary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var beneficiary Beneficiary
+	var err error
+	fmt.Println("starting set_beneficiary")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	beneficiary_id := args[1]
+	authed_by_company := args[3]
+	beneficiary.InactivityMs, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil || beneficiary.InactivityMs <= 0 {
+		return shim.Error("3rd argument must be a positive numeric string")
+	}
+	if beneficiary.InactivityMs < MIN_INACTIVITY_MS {
+		return shim.Error("Inactivity must be at least " + strconv.FormatInt(MIN_INACTIVITY_MS, 10) + " ms")
+	}
+	if owner_id == beneficiary_id {
+		return shim.Error("An owner cannot be their own beneficiary")
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	_, err = get_owner(stub, beneficiary_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + beneficiary_id)
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize beneficiaries for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can name its beneficiary
+	err = check_owner_identity(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	beneficiary.ObjectType = "beneficiary"
+	beneficiary.OwnerId = owner_id
+	beneficiary.BeneficiaryId = beneficiary_id
+	beneficiary.LastActiveMs, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_beneficiary(stub, beneficiary)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_beneficiary")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Check In - the owner is still around, restarts the inactivity clock
+//
+// Inputs - Array of Strings
+//           0     ,         1
+//      owner id   ,  authing company
+// "o9999999999999", "united marbles"
+// ============================================================================================================================
+func check_in(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting check_in")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	authed_by_company := args[1]
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize check ins for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can check in for it
+	err = check_owner_identity(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	beneficiary, found, err := get_beneficiary_doc(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("Owner has no beneficiary - " + owner_id)
+	}
+	err = touch_owner(stub, beneficiary)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end check_in")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Claim Inheritance - the beneficiary takes every marble the owner holds, once the owner has been inactive long enough
+//
+// Each marble moves like a transfer from the owner, so the inspection policy, flags, and the owner's daily limit all apply.
+// A claim is all or nothing, an estate bigger than the owner's daily limit needs an admin to raise it first.
+// Co-owned marbles are left alone, their share holders decide where they go.
+//
+// Inputs - Array of Strings
+//           0     ,        1        ,         2
+//      owner id   ,  beneficiary id ,  authing company
+// "o9999999999999", "o8888888888888", "united marbles"
+// ============================================================================================================================
+func claim_inheritance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting claim_inheritance")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	beneficiary_id := args[1]
+	authed_by_company := args[2]
+
+	beneficiary, found, err := get_beneficiary_doc(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found || beneficiary.BeneficiaryId != beneficiary_id {
+		return shim.Error(beneficiary_id + " is not the beneficiary of " + owner_id)
+	}
+	heir, err := get_owner(stub, beneficiary_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if heir.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize claims for '" + heir.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can claim for it
+	err = check_owner_identity(stub, heir.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now - beneficiary.LastActiveMs < beneficiary.InactivityMs {
+		return shim.Error("Owner was active too recently, claim after " + strconv.FormatInt(beneficiary.LastActiveMs + beneficiary.InactivityMs, 10))
+	}
+
+	// ---- Move The Owner's Marbles ---- //
+	marblesIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer marblesIterator.Close()
+
+	moved := 0
+	for marblesIterator.HasNext() {
+		queryResponse, err := marblesIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		if marble.Owner.Id != owner_id || len(marble.Shares) > 0 {
+			continue
+		}
+
+		err = move_marble(stub, &marble, heir)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		moved++
+	}
+
+	err = record_activity(stub, "inherit", "", owner_id, heir.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("beneficiary", []string{owner_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)                                     //used up
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end claim_inheritance, moved " + strconv.Itoa(moved))
+	return shim.Success([]byte(strconv.Itoa(moved)))
+}
+
+// ============================================================================================================================
+// Get Beneficiary - read an owner's beneficiary and when they were last active
+//
+// Inputs - Array of Strings
+//           0
+//      owner id
+// "o9999999999999"
+// ============================================================================================================================
+func get_beneficiary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	beneficiary, found, err := get_beneficiary_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("Owner has no beneficiary - " + args[0])
+	}
+	beneficiaryAsBytes, _ := json.Marshal(beneficiary)           //convert to array of bytes
+	return shim.Success(beneficiaryAsBytes)
+}
+
+// ============================================================================================================================
+// Inheritance helpers
+// ============================================================================================================================
+func get_beneficiary_doc(stub shim.ChaincodeStubInterface, owner_id string) (Beneficiary, bool, error) {
+	var beneficiary Beneficiary
+	key, err := stub.CreateCompositeKey("beneficiary", []string{owner_id})
+	if err != nil {
+		return beneficiary, false, err
+	}
+	beneficiaryAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return beneficiary, false, errors.New("Failed to get beneficiary")
+	}
+	if beneficiaryAsBytes == nil {
+		return beneficiary, false, nil
+	}
+	json.Unmarshal(beneficiaryAsBytes, &beneficiary)             //un stringify it aka JSON.parse()
+	return beneficiary, true, nil
+}
+
+func put_beneficiary(stub shim.ChaincodeStubInterface, beneficiary Beneficiary) error {
+	key, err := stub.CreateCompositeKey(beneficiary.ObjectType, []string{beneficiary.OwnerId})
+	if err != nil {
+		return err
+	}
+	beneficiaryAsBytes, _ := json.Marshal(beneficiary)           //convert to array of bytes
+	return stub.PutState(key, beneficiaryAsBytes)
+}
+
+func touch_owner(stub shim.ChaincodeStubInterface, beneficiary Beneficiary) error {
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	beneficiary.LastActiveMs = now
+	return put_beneficiary(stub, beneficiary)
+}
+
+// called on every transfer, only owners with a beneficiary have a clock to restart
+func record_owner_active(stub shim.ChaincodeStubInterface, owner_id string) error {
+	beneficiary, found, err := get_beneficiary_doc(stub, owner_id)
+	if err != nil || !found {
+		return err
+	}
+	return touch_owner(stub, beneficiary)
+}
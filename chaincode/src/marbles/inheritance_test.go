@@ -0,0 +1,64 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+const YEAR_MS = "31536000000"
+
+func TestBeneficiaryNeedsMinimumInactivity(t *testing.T) {
+	stub, _, alice, _ := new_identity_fixture(t)
+
+	stub.must_fail(t, alice, "set_beneficiary", "o1", "o2", "1000", COMPANY)
+	stub.must(t, alice, "set_beneficiary", "o1", "o2", YEAR_MS, COMPANY)
+}
+
+func TestClaimInheritanceFollowsTransferRules(t *testing.T) {
+	stub, admin, alice, _ := new_identity_fixture(t)
+	carol := new_identity(t, "Org1MSP", "carol")
+	stub.must(t, carol, "init_owner", "o3", "carol", COMPANY)
+	stub.must(t, alice, "init_marble", "m2", "blue", "35", "o1", COMPANY)
+	stub.must(t, alice, "set_beneficiary", "o1", "o3", YEAR_MS, COMPANY)
+	stub.now += 31536000000 + 1
+
+	// trading needs an inspection, neither marble has one
+	stub.must(t, admin, "set_inspection_policy", "false", "true")
+	stub.must_fail(t, carol, "claim_inheritance", "o1", "o3", COMPANY)
+	stub.must(t, admin, "set_inspection_policy", "false", "false")
+
+	// the owner may only send one marble a day
+	stub.must(t, admin, "set_daily_transfer_limit", "1", "o1")
+	stub.must_fail(t, carol, "claim_inheritance", "o1", "o3", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o1" {
+		t.Fatal("a failed claim should not move anything")
+	}
+
+	stub.must(t, admin, "set_daily_transfer_limit", "2", "o1")
+	stub.must(t, carol, "claim_inheritance", "o1", "o3", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != "o3" || stub.marble(t, "m2").Owner.Id != "o3" {
+		t.Fatal("both marbles should belong to o3")
+	}
+	if stub.holdings("o1") != "0" || stub.holdings("o3") != "2" {
+		t.Fatalf("holdings should be 0 and 2, got %s and %s", stub.holdings("o1"), stub.holdings("o3"))
+	}
+}
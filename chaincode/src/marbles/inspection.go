@@ -0,0 +1,262 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Inspection Definitions
+//
+// The marble holds its latest result. A request is its own record under composite key "inspection_request" [marble id],
+// so asking for a new inspection doesn't take away a pass the marble already has.
+// ============================================================================================================================
+const INSPECTION_POLICY_KEY = "_inspection_policy"
+
+type Inspection struct {
+	Result     string `json:"result"`               //"pass" or "fail"
+	ReportHash string `json:"reportHash,omitempty"` //hash of the off chain inspection report
+	Inspector  string `json:"inspector,omitempty"`  //invoker id of the inspector
+	Timestamp  int64  `json:"timestamp"`            //ms, tx time of the result
+}
+
+type InspectionRequest struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	MarbleId    string `json:"marbleId"`
+	RequestedBy string `json:"requestedBy"` //owner id
+	Timestamp   int64  `json:"timestamp"`   //ms, tx time
+}
+
+type InspectionPolicy struct {
+	RequiredForListing bool `json:"requiredForListing"`
+	RequiredForTrading bool `json:"requiredForTrading"`
+}
+
+// ============================================================================================================================
+// Request Inspection - owner asks for a marble to be inspected
+//
+// Inputs - Array of Strings
+//       0     ,         1
+//  marble id  ,  authing company
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func request_inspection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting request_inspection")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[1]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot request inspections for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can ask
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var request InspectionRequest
+	request.ObjectType = "inspection_request"
+	request.MarbleId = marble_id
+	request.RequestedBy = marble.Owner.Id
+	request.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(request.ObjectType, []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	requestAsBytes, _ := json.Marshal(request)                   //convert to array of bytes
+	err = stub.PutState(key, requestAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end request_inspection")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Record Inspection - store the result of an inspection. Inspector role only
+//
+// Inputs - Array of Strings
+//       0     ,     1      ,       2
+//  marble id  ,   result   ,  report hash
+// "m999999999",   "pass"   ,  "9f86d08..."
+// ============================================================================================================================
+func record_inspection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting record_inspection")
+
+	// input sanitation, the report hash can be longer than the usual limit
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[2]) == 0 {
+		return shim.Error("Argument 2 must be a non-empty string")
+	}
+
+	marble_id := args[0]
+	result := args[1]
+	report_hash := args[2]
+	if result != "pass" && result != "fail" {
+		return shim.Error("Result must be 'pass' or 'fail'")
+	}
+
+	err = check_role(stub, "inspector")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	inspector, err := get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey("inspection_request", []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	requestAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get inspection request")
+	}
+	if requestAsBytes == nil {
+		return shim.Error("No inspection has been requested for " + marble_id)
+	}
+	err = stub.DelState(key)                                     //answered
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	marble.Inspection = &Inspection{Result: result, ReportHash: report_hash, Inspector: inspector, Timestamp: now}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end record_inspection")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Inspection Policy - choose if listing and/or trading needs a passing inspection. Admin only
+//
+// Inputs - Array of Strings
+//           0          ,          1
+//  required for listing, required for trading
+//        "true"        ,       "false"
+// ============================================================================================================================
+func set_inspection_policy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_inspection_policy")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var policy InspectionPolicy
+	policy.RequiredForListing, err = strconv.ParseBool(args[0])
+	if err != nil {
+		return shim.Error("1st argument must be 'true' or 'false'")
+	}
+	policy.RequiredForTrading, err = strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be 'true' or 'false'")
+	}
+
+	policyAsBytes, _ := json.Marshal(policy)                     //convert to array of bytes
+	err = stub.PutState(INSPECTION_POLICY_KEY, policyAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_inspection_policy")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Inspection Policy - read the inspection policy
+//
+// Inputs - none
+// ============================================================================================================================
+func get_inspection_policy(stub shim.ChaincodeStubInterface) pb.Response {
+	policy, err := get_inspection_policy_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	policyAsBytes, _ := json.Marshal(policy)                     //convert to array of bytes
+	return shim.Success(policyAsBytes)
+}
+
+// ============================================================================================================================
+// Inspection helpers
+// ============================================================================================================================
+func get_inspection_policy_config(stub shim.ChaincodeStubInterface) (InspectionPolicy, error) {
+	var policy InspectionPolicy
+	policyAsBytes, err := stub.GetState(INSPECTION_POLICY_KEY)
+	if err != nil {
+		return policy, errors.New("Failed to get inspection policy")
+	}
+	if policyAsBytes == nil {                                    //nothing required until an admin says so
+		return policy, nil
+	}
+	err = json.Unmarshal(policyAsBytes, &policy)                 //un stringify it aka JSON.parse()
+	if err != nil {
+		return policy, errors.New("Failed to parse inspection policy")
+	}
+	return policy, nil
+}
+
+func passed_inspection(marble Marble) bool {
+	return marble.Inspection != nil && marble.Inspection.Result == "pass"
+}
@@ -0,0 +1,40 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRequestInspectionKeepsAPass(t *testing.T) {
+	stub, admin, alice, mallory := new_identity_fixture(t)
+	stub.must(t, admin, "set_inspection_policy", "false", "true")
+	stub.must_fail(t, admin, "record_inspection", "m1", "pass", "9f86d08")   //nothing requested
+	stub.must(t, alice, "request_inspection", "m1", COMPANY)
+	stub.must(t, admin, "record_inspection", "m1", "pass", "9f86d08")
+
+	stub.must_fail(t, mallory, "request_inspection", "m1", COMPANY)
+	stub.must(t, alice, "request_inspection", "m1", COMPANY)
+	if !passed_inspection(stub.marble(t, "m1")) {
+		t.Fatal("a new request should not take away the pass")
+	}
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+}
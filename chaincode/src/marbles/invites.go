@@ -0,0 +1,194 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Invitation Definitions - gated deployments need a one time code to run init_owner
+//
+// The admin makes up the codes off chain and only stores their sha256, so reading the ledger doesn't give codes away.
+// Codes are stored under composite key "invite" [code hash] and are kept once used so they can't be used again.
+// ============================================================================================================================
+const INVITES_REQUIRED_KEY = "_invites_required"
+
+type Invite struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	CodeHash   string `json:"codeHash"`
+	CreatedBy  string `json:"createdBy"`        //invoker id
+	CreatedAt  int64  `json:"createdAt"`        //ms, tx time
+	UsedBy     string `json:"usedBy,omitempty"` //owner id
+	UsedAt     int64  `json:"usedAt,omitempty"`
+}
+
+// ============================================================================================================================
+// Create Invites - store invitation code hashes. Admin only
+//
+// Inputs - Array of Strings
+//           0...
+//     sha256 hex of codes
+// "5d41402abc4b2a76b9719d911017c592...", "7d793037a0760186574b0282f2f435e7..."
+// ============================================================================================================================
+func create_invites(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting create_invites")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, code_hash := range args {
+		code_hash = strings.ToLower(code_hash)
+		hashAsBytes, err := hex.DecodeString(code_hash)
+		if err != nil || len(hashAsBytes) != 32 {
+			return shim.Error("Invitation codes must be given as sha256 hex - " + code_hash)
+		}
+		invite, err := get_invite(stub, code_hash)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(invite.CodeHash) > 0 {
+			return shim.Error("Invitation code already exists - " + code_hash)
+		}
+
+		invite.ObjectType = "invite"
+		invite.CodeHash = code_hash
+		invite.CreatedBy = invoker
+		invite.CreatedAt = now
+		err = put_invite(stub, invite)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end create_invites")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Invites Required - turn invitation gated registration on or off. Admin only
+//
+// Inputs - Array of Strings
+//      0
+//   required
+//    "true"
+// ============================================================================================================================
+func set_invites_required(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_invites_required")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	required, err := strconv.ParseBool(args[0])
+	if err != nil {
+		return shim.Error("1st argument must be 'true' or 'false'")
+	}
+	err = stub.PutState(INVITES_REQUIRED_KEY, []byte(strconv.FormatBool(required)))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_invites_required")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Invitation helpers
+// ============================================================================================================================
+
+// use up an invitation code for a new owner, does nothing if invites are not required
+func consume_invite(stub shim.ChaincodeStubInterface, code string, owner_id string) error {
+	requiredAsBytes, err := stub.GetState(INVITES_REQUIRED_KEY)
+	if err != nil {
+		return errors.New("Failed to get invitation setting")
+	}
+	if string(requiredAsBytes) != "true" {
+		return nil
+	}
+	if len(code) == 0 {
+		return errors.New("An invitation code is required to register")
+	}
+
+	codeHash := sha256.Sum256([]byte(code))
+	invite, err := get_invite(stub, hex.EncodeToString(codeHash[:]))
+	if err != nil {
+		return err
+	}
+	if len(invite.CodeHash) == 0 {
+		return errors.New("Invitation code is not valid")
+	}
+	if len(invite.UsedBy) > 0 {
+		return errors.New("Invitation code was already used")
+	}
+
+	invite.UsedBy = owner_id
+	invite.UsedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	return put_invite(stub, invite)
+}
+
+// errors only if the ledger read fails, a missing invite comes back empty
+func get_invite(stub shim.ChaincodeStubInterface, code_hash string) (Invite, error) {
+	var invite Invite
+	key, err := stub.CreateCompositeKey("invite", []string{code_hash})
+	if err != nil {
+		return invite, err
+	}
+	inviteAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return invite, errors.New("Failed to get invitation")
+	}
+	json.Unmarshal(inviteAsBytes, &invite)                       //un stringify it aka JSON.parse()
+	return invite, nil
+}
+
+func put_invite(stub shim.ChaincodeStubInterface, invite Invite) error {
+	key, err := stub.CreateCompositeKey(invite.ObjectType, []string{invite.CodeHash})
+	if err != nil {
+		return err
+	}
+	inviteAsBytes, _ := json.Marshal(invite)                     //convert to array of bytes
+	return stub.PutState(key, inviteAsBytes)
+}
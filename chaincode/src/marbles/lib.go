@@ -20,11 +20,16 @@ under the License.
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
 )
 
 // ============================================================================================================================
@@ -63,6 +68,258 @@ func get_owner(stub shim.ChaincodeStubInterface, id string) (Owner, error) {
 	return owner, nil
 }
 
+// ============================================================================================================================
+// Put Marble - store a marble asset into the ledger, keeps its last modified metadata up to date
+// ============================================================================================================================
+func put_marble(stub shim.ChaincodeStubInterface, marble Marble) error {
+	return put_marble_as(stub, marble, "updated")
+}
+
+// same but the watchers hear about it as change, see WatchEvent
+func put_marble_as(stub shim.ChaincodeStubInterface, marble Marble, change string) error {
+	err := stamp_marble(stub, &marble)                         //every write stamps who/when/which tx
+	if err != nil {
+		return err
+	}
+	marbleAsBytes, _ := json.Marshal(marble)                   //convert to array of bytes
+	err = stub.PutState(marble.Id, marbleAsBytes)              //store marble by its Id
+	if err != nil {
+		return err
+	}
+	return notify_watchers(stub, marble, change)
+}
+
+// ============================================================================================================================
+// Stamp Marble - fill in the last modified metadata, same values every time within a tx
+//
+// put_marble() does this on its own copy, call it too if you need the marble exactly as it was stored
+// ============================================================================================================================
+func stamp_marble(stub shim.ChaincodeStubInterface, marble *Marble) error {
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	marble.LastModifiedBy = invoker
+	marble.LastModifiedAt = now
+	marble.LastModifiedTxId = stub.GetTxID()
+	return nil
+}
+
+// ============================================================================================================================
+// Create Marble - store a brand new marble, shared by every function that mints marbles
+//
+// Errors if the id is taken or the size is out of bounds. Fills in the docType, the first lifecycle status, the default rarity,
+// the created metadata and the next serial for its color, and counts the marble against its rarity's mint cap.
+// ============================================================================================================================
+func create_marble(stub shim.ChaincodeStubInterface, marble *Marble) error {
+	_, err := get_marble(stub, marble.Id)
+	if err == nil {
+		fmt.Println("This marble already exists - " + marble.Id)
+		return errors.New("This marble already exists - " + marble.Id)  //all stop a marble by this id exists
+	}
+
+	marble.ObjectType = "marble"
+	err = check_size(stub, marble.Size)
+	if err != nil {
+		return err
+	}
+	if len(marble.Rarity) == 0 {
+		marble.Rarity = "common"
+	}
+	err = mint_rarity(stub, marble.Rarity, marble.Id)          //count it against the rarity's mint cap
+	if err != nil {
+		return err
+	}
+	err = use_mint_quota(stub, marble.Color)                   //and against the caller's org quota for its color
+	if err != nil {
+		return err
+	}
+	err = assign_serial(stub, marble)                          //next serial for its color
+	if err != nil {
+		return err
+	}
+	err = claim_fingerprint(stub, marble)                      //only does anything if it came with physical data
+	if err != nil {
+		return err
+	}
+
+	lifecycle, err := get_lifecycle_config(stub)               //new marbles start in the first lifecycle state
+	if err != nil {
+		return err
+	}
+	marble.Status = lifecycle.Initial
+
+	marble.CreatedBy, err = get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	marble.CreatedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+	marble.CreatedTxId = stub.GetTxID()
+
+	err = track_holdings(stub, marble.Owner.Id, 1)
+	if err != nil {
+		return err
+	}
+	err = record_activity(stub, "create", marble.Id, "", marble.Owner.Id)
+	if err != nil {
+		return err
+	}
+	err = stamp_marble(stub, marble)                           //so the caller has the marble as stored
+	if err != nil {
+		return err
+	}
+	err = put_marble(stub, *marble)
+	if err != nil {
+		return err
+	}
+	return emit_marble_event(stub, "marble_created", *marble, "", marble.Owner.Id)
+}
+
+// ============================================================================================================================
+// Remove Marble - delete a marble and its index entries, shared by every function that removes marbles
+// ============================================================================================================================
+func remove_marble(stub shim.ChaincodeStubInterface, marble Marble) error {
+	if len(marble.Shares) > 0 {                                //the other share holders would lose their part
+		return errors.New("Marble is co-owned and cannot be removed - " + marble.Id)
+	}
+	err := stub.DelState(marble.Id)                            //remove the key from chaincode state
+	if err != nil {
+		return errors.New("Failed to delete state")
+	}
+
+	err = track_holdings(stub, marble.Owner.Id, -1)
+	if err != nil {
+		return err
+	}
+	err = index_tags(stub, marble.Id, marble.Tags, false)
+	if err != nil {
+		return err
+	}
+	err = unindex_serial(stub, marble)                         //the serial itself isn't reused
+	if err != nil {
+		return err
+	}
+	err = release_fingerprint(stub, marble)
+	if err != nil {
+		return err
+	}
+	err = record_activity(stub, "delete", marble.Id, marble.Owner.Id, "")
+	if err != nil {
+		return err
+	}
+	err = notify_watchers(stub, marble, "deleted")
+	if err != nil {
+		return err
+	}
+	err = emit_marble_event(stub, "marble_deleted", marble, marble.Owner.Id, "")
+	if err != nil {
+		return err
+	}
+
+	// remove it from the rarity index, the mint count stays (caps are on minting, not on supply)
+	return unindex_rarity(stub, marble)
+}
+
+// ============================================================================================================================
+// Put Owner - store an owner asset into the ledger
+// ============================================================================================================================
+func put_owner(stub shim.ChaincodeStubInterface, owner Owner) error {
+	ownerAsBytes, _ := json.Marshal(owner)                     //convert to array of bytes
+	return stub.PutState(owner.Id, ownerAsBytes)               //store owner by its Id
+}
+
+// ============================================================================================================================
+// Transfer Marble - change the owner of a marble and store it, shared by every function that moves marbles
+//
+// The marble passed in is updated to how it was stored.
+// ============================================================================================================================
+func transfer_marble(stub shim.ChaincodeStubInterface, marble *Marble, owner Owner) error {
+	if marble.Owner.Id == POOL_OWNER_ID {                      //pool marbles only leave via claim_from_pool()
+		return errors.New("Marble is in the pool, it must be claimed - " + marble.Id)
+	}
+	return move_marble(stub, marble, owner)
+}
+
+// ============================================================================================================================
+// Move Marble - the part of transfer_marble() that does the work, only call directly if the rules allow any owner
+// ============================================================================================================================
+func move_marble(stub shim.ChaincodeStubInterface, marble *Marble, owner Owner) error {
+	if len(marble.Shares) > 0 {                                //co-owned marbles move via approve_transfer()
+		return errors.New("Marble is co-owned, share holders must approve the transfer - " + marble.Id)
+	}
+	return change_owner(stub, marble, owner)
+}
+
+// ============================================================================================================================
+// Change Owner - the rules and records every transfer goes through, then the owner change
+//
+// move_marble() without the co-owned check, transfer_shares() calls it when a new lead share holder takes the marble.
+// ============================================================================================================================
+func change_owner(stub shim.ChaincodeStubInterface, marble *Marble, owner Owner) error {
+	policy, err := get_inspection_policy_config(stub)
+	if err != nil {
+		return err
+	}
+	if policy.RequiredForTrading && !passed_inspection(*marble) {
+		return errors.New("Marble must pass inspection before it can be traded - " + marble.Id)
+	}
+	err = check_daily_limit(stub, marble.Owner.Id)
+	if err != nil {
+		return err
+	}
+	err = check_velocity(stub, marble, owner)
+	if err != nil {
+		return err
+	}
+	err = record_trade_badges(stub, marble.Owner.Id, owner.Id)
+	if err != nil {
+		return err
+	}
+	err = record_owner_active(stub, marble.Owner.Id)          //restarts the sender's inheritance clock
+	if err != nil {
+		return err
+	}
+	err = record_activity(stub, "transfer", marble.Id, marble.Owner.Id, owner.Id)
+	if err != nil {
+		return err
+	}
+	err = put_transfer_receipt(stub, marble.Id, marble.Owner.Id, owner.Id)
+	if err != nil {
+		return err
+	}
+	old_owner_id := marble.Owner.Id
+	marble.Owner.Id = owner.Id                                 //change the owner
+	marble.Owner.Username = owner.Username
+	marble.Owner.Company = owner.Company
+	err = stamp_marble(stub, marble)
+	if err != nil {
+		return err
+	}
+	err = put_marble_as(stub, *marble, "transferred")          //rewrite the marble with id as key
+	if err != nil {
+		return err
+	}
+	return emit_marble_event(stub, "owner_changed", *marble, old_owner_id, owner.Id)
+}
+
+// ========================================================
+// Get Tx Time - the transaction's timestamp in ms, same for every peer that endorses it
+// ========================================================
+func get_tx_time_ms(stub shim.ChaincodeStubInterface) (int64, error) {
+	txTime, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return txTime.Seconds * 1000 + int64(txTime.Nanos) / 1000000, nil
+}
+
 // ========================================================
 // Input Sanitation - dumb input checking, look for empty strings
 // ========================================================
@@ -77,3 +334,54 @@ func sanitize_arguments(strs []string) error{
 	}
 	return nil
 }
+
+
+// ========================================================
+// Get Invoker - build an id for whoever submitted this transaction, from their enrollment cert
+//
+// Returns - string, "<msp id>.<sha256 of cert>"
+// ========================================================
+func get_invoker(stub shim.ChaincodeStubInterface) (string, error) {
+	creator, err := get_creator(stub)
+	if err != nil {
+		return "", err
+	}
+	certHash := sha256.Sum256(creator.IdBytes)                 //hash the cert, its shorter and its stable
+	return creator.Mspid + "." + hex.EncodeToString(certHash[:]), nil
+}
+
+// ========================================================
+// Get Invoker MSP - the msp id (organization) of whoever submitted this transaction
+// ========================================================
+func get_invoker_msp(stub shim.ChaincodeStubInterface) (string, error) {
+	creator, err := get_creator(stub)
+	if err != nil {
+		return "", err
+	}
+	return creator.Mspid, nil
+}
+
+func get_creator(stub shim.ChaincodeStubInterface) (msp.SerializedIdentity, error) {
+	var creator msp.SerializedIdentity
+	creatorAsBytes, err := stub.GetCreator()                   //serialized identity of the tx submitter
+	if err != nil {
+		return creator, errors.New("Failed to get creator of transaction")
+	}
+	err = proto.Unmarshal(creatorAsBytes, &creator)
+	if err != nil {
+		return creator, errors.New("Failed to parse creator of transaction")
+	}
+	return creator, nil
+}
+
+// ========================================================
+// Contains - true if the string is in the list
+// ========================================================
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Lifecycle Definitions - the state machine that drives a marble's status
+// ============================================================================================================================
+const LIFECYCLE_KEY = "_lifecycle"
+
+type Lifecycle struct {
+	Initial     string       `json:"initial"` //status of newly created marbles
+	Transitions []Transition `json:"transitions"`
+}
+
+type Transition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Role string `json:"role,omitempty"` //role the invoker needs, empty means the marble's owner
+}
+
+// used until an admin stores their own with set_lifecycle()
+var default_lifecycle = Lifecycle{
+	Initial: "manufactured",
+	Transitions: []Transition{
+		{From: "manufactured", To: "inspected", Role: "inspector"},
+		{From: "inspected", To: "listed"},
+		{From: "listed", To: "sold"},
+		{From: "sold", To: "delivered"},
+	},
+}
+
+// ============================================================================================================================
+// Get Lifecycle Config - get the state machine from ledger, or the default if none was set
+// ============================================================================================================================
+func get_lifecycle_config(stub shim.ChaincodeStubInterface) (Lifecycle, error) {
+	var lifecycle Lifecycle
+	lifecycleAsBytes, err := stub.GetState(LIFECYCLE_KEY)
+	if err != nil {
+		return lifecycle, errors.New("Failed to get lifecycle")
+	}
+	if lifecycleAsBytes == nil {
+		return default_lifecycle, nil
+	}
+	err = json.Unmarshal(lifecycleAsBytes, &lifecycle)         //un stringify it aka JSON.parse()
+	if err != nil {
+		return lifecycle, errors.New("Failed to parse lifecycle")
+	}
+	return lifecycle, nil
+}
+
+// ============================================================================================================================
+// Get Lifecycle - read the state machine
+//
+// Inputs - none
+// ============================================================================================================================
+func get_lifecycle(stub shim.ChaincodeStubInterface) pb.Response {
+	lifecycle, err := get_lifecycle_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	lifecycleAsBytes, _ := json.Marshal(lifecycle)             //convert to array of bytes
+	return shim.Success(lifecycleAsBytes)
+}
+
+// ============================================================================================================================
+// Set Lifecycle - replace the state machine. Admin only
+//
+// Inputs - Array of Strings
+//   0
+//   lifecycle json
+//  "{"initial":"made","transitions":[{"from":"made","to":"sold","role":"seller"}]}"
+// ============================================================================================================================
+func set_lifecycle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_lifecycle")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var lifecycle Lifecycle
+	err = json.Unmarshal([]byte(args[0]), &lifecycle)
+	if err != nil {
+		return shim.Error("Lifecycle must be valid json")
+	}
+	if len(lifecycle.Initial) == 0 {
+		return shim.Error("Lifecycle must have an initial status")
+	}
+	for _, t := range lifecycle.Transitions {
+		if len(t.From) == 0 || len(t.To) == 0 {
+			return shim.Error("Every transition needs a from and a to status")
+		}
+	}
+
+	lifecycleAsBytes, _ := json.Marshal(lifecycle)             //store our normalized copy, not the raw arg
+	err = stub.PutState(LIFECYCLE_KEY, lifecycleAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_lifecycle")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Transition - move a marble to a new lifecycle status, if the state machine allows it
+//
+// A transition with a role needs the invoker to hold it, one without is up to the marble's owner.
+//
+// Inputs - Array of Strings
+//       0     ,      1
+//  marble id  ,  new status
+// "m999999999",  "inspected"
+// ============================================================================================================================
+func transition(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting transition")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	new_status := args[1]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	lifecycle, err := get_lifecycle_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	current_status := marble.Status
+	if len(current_status) == 0 {                                //marbles from before the lifecycle existed
+		current_status = lifecycle.Initial
+	}
+
+	// find the transition
+	var found *Transition
+	for i, t := range lifecycle.Transitions {
+		if t.From == current_status && t.To == new_status {
+			found = &lifecycle.Transitions[i]
+			break
+		}
+	}
+	if found == nil {
+		return shim.Error("Marble cannot go from '" + current_status + "' to '" + new_status + "'")
+	}
+	if len(found.Role) > 0 {
+		err = check_role(stub, found.Role)
+	} else {
+		err = check_owner_identity(stub, marble.Owner.Id)        //only the owner's identity (or an admin) can move it along
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if new_status == "listed" {
+		policy, err := get_inspection_policy_config(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if policy.RequiredForListing && !passed_inspection(marble) {
+			return shim.Error("Marble must pass inspection before it can be listed - " + marble_id)
+		}
+	}
+
+	marble.Status = new_status
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transition")
+	return shim.Success(nil)
+}
@@ -0,0 +1,164 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Custody Locations ----- //
+// physical custody is tracked apart from ownership, a marble can sit in a warehouse while it's sold twice.
+// stored under composite key "location" [marble id, padded tx time, tx id] so a partial key scan is in time order
+type LocationEvent struct {
+	ObjectType string  `json:"docType"` //field for couchdb
+	MarbleId   string  `json:"marbleId"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	Facility   string  `json:"facility"`
+	RecordedBy string  `json:"recordedBy"` //invoker id
+	RecordedAt int64   `json:"recordedAt"` //ms, tx time
+	TxId       string  `json:"txId"`
+}
+
+// ============================================================================================================================
+// Record Location - log where a marble is. Needs the custodian role
+//
+// Inputs - Array of Strings
+//       0     ,     1     ,     2      ,      3
+//  marble id  ,  latitude , longitude  ,  facility
+// "m999999999", "40.7128" , "-74.0060" , "warehouse 7"
+// ============================================================================================================================
+func record_location(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting record_location")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	facility := args[3]
+	lat, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return shim.Error("Latitude must be a numeric string between -90 and 90")
+	}
+	lon, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return shim.Error("Longitude must be a numeric string between -180 and 180")
+	}
+
+	err = check_role(stub, "custodian")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, err = get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var event LocationEvent
+	event.ObjectType = "location"
+	event.MarbleId = marble_id
+	event.Lat = lat
+	event.Lon = lon
+	event.Facility = facility
+	event.TxId = stub.GetTxID()
+	event.RecordedBy, err = get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	event.RecordedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	padded_time := fmt.Sprintf("%015d", event.RecordedAt)         //pad it so keys sort by time
+	key, err := stub.CreateCompositeKey("location", []string{marble_id, padded_time, event.TxId})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	eventAsBytes, _ := json.Marshal(event)                       //convert to array of bytes
+	err = stub.PutState(key, eventAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end record_location")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Location History - every location logged for a marble, oldest first
+//
+// Inputs - Array of Strings
+//       0      ,    1 (optional)
+//  marble id   ,      bookmark
+// "m999999999" , "001490898165086:2b2d7c4c..."
+// ============================================================================================================================
+func get_location_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var events []LocationEvent
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("location", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position := keyParts[1] + ":" + keyParts[2]              //tx time then tx id, sorts the same as the keys
+		if results.skip(position) {
+			continue
+		}
+		if results.full(position) {
+			break
+		}
+		var event LocationEvent
+		json.Unmarshal(queryResponse.Value, &event)              //un stringify it aka JSON.parse()
+		events = append(events, event)
+	}
+
+	return results.response(events)
+}
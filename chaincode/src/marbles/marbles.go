@@ -37,25 +37,120 @@ type SimpleChaincode struct {
 
 // ----- Marbles ----- //
 type Marble struct {
-	ObjectType string        `json:"docType"` //field for couchdb
-	Id       string          `json:"id"`      //the fieldtags are needed to keep case from bouncing around
-	Color      string        `json:"color"`
-	Size       int           `json:"size"`    //size in mm of marble
-	Owner      OwnerRelation `json:"owner"`
+	ObjectType        string            `json:"docType"` //field for couchdb
+	Id                string            `json:"id"`      //the fieldtags are needed to keep case from bouncing around
+	Color             string            `json:"color"`
+	Size              int               `json:"size"` //size in mm of marble
+	Owner             OwnerRelation     `json:"owner"`
+	Shares            []Share           `json:"shares,omitempty"`            //only set if the marble is co-owned, Owner is then the lead share holder
+	ApprovalThreshold int               `json:"approvalThreshold,omitempty"` //percent of shares that must approve a full transfer
+	PendingTransfer   *PendingTransfer  `json:"pendingTransfer,omitempty"`
+	Status            string            `json:"status,omitempty"`     //lifecycle state, see lifecycle.go
+	Inspection        *Inspection       `json:"inspection,omitempty"` //latest inspection, see inspection.go
+	Flagged           bool              `json:"flagged,omitempty"`    //tripped a velocity rule, cannot trade until cleared
+	FlaggedAt         int64             `json:"flaggedAt,omitempty"`
+	Rarity            string            `json:"rarity,omitempty"`      //common, rare or legendary, see rarity.go
+	CraftedFrom       []string          `json:"craftedFrom,omitempty"` //ids of the marbles burned to craft this one
+	TemplateId        string            `json:"templateId,omitempty"`  //template it was minted from, see templates.go
+	DropId            string            `json:"dropId,omitempty"`      //drop it was claimed from, see drops.go
+	Serial            int               `json:"serial,omitempty"`      //per color, see serials.go
+	Attributes        map[string]string `json:"attributes,omitempty"`
+	CreatedBy         string            `json:"createdBy,omitempty"` //invoker id, see get_invoker()
+	CreatedAt         int64             `json:"createdAt,omitempty"` //ms, tx time
+	CreatedTxId       string            `json:"createdTxId,omitempty"`
+	LastModifiedBy    string            `json:"lastModifiedBy,omitempty"` //set by put_marble() on every write
+	LastModifiedAt    int64             `json:"lastModifiedAt,omitempty"`
+	LastModifiedTxId  string            `json:"lastModifiedTxId,omitempty"`
+	Protected         bool              `json:"protected,omitempty"`    //deletes need request_delete() + approve_delete()
+	Tags              []string          `json:"tags,omitempty"`         //indexed by composite key "tag" + tag + marble id
+	MetadataURI       string            `json:"metadataURI,omitempty"`  //ERC-721 style metadata json, see metadata.go
+	MetadataHash      string            `json:"metadataHash,omitempty"` //sha256 hex of that json
+	Physical          *Physical         `json:"physical,omitempty"`     //weight and dimensions, see physical.go
+	Fingerprint       string            `json:"fingerprint,omitempty"`  //hash of the physical attributes, unique, see fingerprint.go
+	Description       string            `json:"description,omitempty"`  //free text, searchable with search_text()
+	Notes             string            `json:"notes,omitempty"`
+}
+
+// ----- Co-Ownership ----- //
+type Share struct {
+	OwnerId string `json:"ownerId"`
+	Percent int    `json:"percent"`
+}
+
+type PendingTransfer struct {
+	ToOwnerId string   `json:"toOwnerId"`
+	Approvals []string `json:"approvals"` //owner ids of the share holders that approved
 }
 
 // ----- Owners ----- //
 type Owner struct {
-	ObjectType string `json:"docType"`     //field for couchdb
+	ObjectType string `json:"docType"` //field for couchdb
 	Id         string `json:"id"`
 	Username   string `json:"username"`
 	Company    string `json:"company"`
+	PublicKey  string `json:"publicKey,omitempty"` //PEM, used to verify payloads the owner signed off chain
+	Flagged    bool   `json:"flagged,omitempty"`   //tripped a velocity rule, cannot trade until cleared
+	FlaggedAt  int64  `json:"flaggedAt,omitempty"`
+	Desk       bool   `json:"desk,omitempty"`     //a trading desk, see desks.go
+	Identity   string `json:"identity,omitempty"` //fingerprint of the identity that controls this owner, see identity.go
 }
 
 type OwnerRelation struct {
-	Id         string `json:"id"`
-	Username   string `json:"username"`    //this is mostly cosmetic/handy, the real relation is by Id not Username
-	Company    string `json:"company"`     //this is mostly cosmetic/handy, the real relation is by Id not Company
+	Id       string `json:"id"`
+	Username string `json:"username"` //this is mostly cosmetic/handy, the real relation is by Id not Username
+	Company  string `json:"company"`  //this is mostly cosmetic/handy, the real relation is by Id not Company
+}
+
+// ----- Read Only Functions ----- //
+// these still work while the system is paused, everything else is blocked
+var read_only_functions = map[string]bool{
+	"read":                      true,
+	"read_everything":           true,
+	"getHistory":                true,
+	"getMarblesByRange":         true,
+	"whoami":                    true,
+	"get_lifecycle":             true,
+	"get_inspection_policy":     true,
+	"get_warranty":              true,
+	"verify_document":           true,
+	"get_velocity_rules":        true,
+	"get_compliance_report":     true,
+	"get_marbles_by_rarity":     true,
+	"get_rarity_caps":           true,
+	"get_recipe":                true,
+	"get_badges":                true,
+	"get_template":              true,
+	"get_operation":             true,
+	"get_marbles_by_tag":        true,
+	"get_allowed_units":         true,
+	"get_marbles_by_size_range": true,
+	"get_location_history":      true,
+	"search_text":               true,
+	"get_recent_activity":       true,
+	"get_size_bounds":           true,
+	"get_watchlist":             true,
+	"get_daily_transfer_limit":  true,
+	"get_mint_quota":            true,
+	"state_digest":              true,
+	"diff_marble":               true,
+	"read_consistent":           true,
+	"get_history_paginated":     true,
+	"get_transfer_receipts":     true,
+	"get_max_results":           true,
+	"get_drop":                  true,
+	"get_nonce":                 true,
+	"get_beneficiary":           true,
+	"query_marbles_by_owner":    true,
+	"get_desk":                  true,
+	"get_desk_audit":            true,
+	"list_marbles":              true,
+	"get_marble_by_serial":      true,
+	"get_doc_types":             true,
+	"get_custom_doc":            true,
+	"get_marble_history":        true,
+	"get_marble_by_fingerprint": true,
+	"get_identity":              true,
+	"get_my_contact_info":       true,
 }
 
 // ============================================================================================================================
@@ -94,6 +189,18 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 		return shim.Error(err.Error())
 	}
 
+	// the instantiator becomes the first admin
+	err = init_admins(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// make the pool owner up front, nobody can register its id (see pool.go)
+	_, err = get_pool_owner(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// this is a very simple dumb test.  let's write to the ledger and error on any errors
 	err = stub.PutState("selftest", []byte(strconv.Itoa(Aval))) //making a test var "selftest", its handy to read this right away to test the network
 	if err != nil {
@@ -113,6 +220,46 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println(" ")
 	fmt.Println("starting invoke, for - " + function)
 
+	// every function's arg count and kinds are in one table, see args.go
+	err := check_args(function, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// block mutating functions while paused (unpause itself must get through)
+	if !read_only_functions[function] && function != "unpause" {
+		paused, err := is_paused(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if paused {
+			return shim.Error("System paused - '" + function + "' is not allowed until an admin unpauses")
+		}
+	}
+
+	// read only functions go straight through, everything else also writes an operation log
+	if read_only_functions[function] {
+		return t.dispatch(stub, function, args)
+	}
+	recorder := &op_recorder{ChaincodeStubInterface: stub}
+	response := t.dispatch(recorder, function, args)
+	if response.Status == shim.OK {
+		err := put_operation(stub, function, args, recorder)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = flush_events(stub, recorder)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return response
+}
+
+// ============================================================================================================================
+// Dispatch - route the function to its handler
+// ============================================================================================================================
+func (t *SimpleChaincode) dispatch(stub shim.ChaincodeStubInterface, function string, args []string) pb.Response {
 	// Handle different functions
 	if function == "init" {                    //initialize the chaincode state, used as reset
 		return t.Init(stub)
@@ -128,23 +275,239 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return set_owner(stub, args)
 	} else if function == "init_owner"{        //create a new marble owner
 		return init_owner(stub, args)
+	} else if function == "read_consistent"{   //read several keys from the same ledger snapshot
+		return read_consistent(stub, args)
+	} else if function == "init_owners_bulk"{  //create many owners in one go (admin)
+		return init_owners_bulk(stub, args)
 	} else if function == "read_everything"{   //read everything, (owners + marbles + companies)
-		return read_everything(stub)
+		return read_everything(stub, args)
 	} else if function == "getHistory"{        //read history of a marble (audit)
 		return getHistory(stub, args)
+	} else if function == "get_history_paginated"{ //read history of a marble a page at a time
+		return get_history_paginated(stub, args)
 	} else if function == "getMarblesByRange"{ //read a bunch of marbles by start and stop id
 		return getMarblesByRange(stub, args)
+	} else if function == "register_public_key"{ //store an owner's public key for off chain signatures
+		return register_public_key(stub, args)
+	} else if function == "set_owner_signed"{  //change owner of a marble with the current owner's off chain signature
+		return set_owner_signed(stub, args)
+	} else if function == "schedule_transfer"{ //record a transfer that can run after an unlock time
+		return schedule_transfer(stub, args)
+	} else if function == "execute_scheduled_transfer"{ //run a scheduled transfer once its unlocked
+		return execute_scheduled_transfer(stub, args)
+	} else if function == "cancel_scheduled_transfer"{ //drop a scheduled transfer before it runs
+		return cancel_scheduled_transfer(stub, args)
+	} else if function == "split_ownership"{   //turn a marble into a co-owned marble
+		return split_ownership(stub, args)
+	} else if function == "transfer_shares"{   //move a percent of a co-owned marble to another owner
+		return transfer_shares(stub, args)
+	} else if function == "approve_transfer"{  //share holder approves a full transfer of a co-owned marble
+		return approve_transfer(stub, args)
+	} else if function == "cancel_transfer"{   //share holder withdraws their approval of a full transfer
+		return cancel_transfer(stub, args)
+	} else if function == "transition"{        //move a marble to a new lifecycle state
+		return transition(stub, args)
+	} else if function == "set_lifecycle"{     //replace the lifecycle state machine (admin)
+		return set_lifecycle(stub, args)
+	} else if function == "get_lifecycle"{     //read the lifecycle state machine
+		return get_lifecycle(stub)
+	} else if function == "request_inspection"{ //owner asks for a marble to be inspected
+		return request_inspection(stub, args)
+	} else if function == "record_inspection"{ //store an inspection result (inspector)
+		return record_inspection(stub, args)
+	} else if function == "set_inspection_policy"{ //require passing inspections for listing/trading (admin)
+		return set_inspection_policy(stub, args)
+	} else if function == "get_inspection_policy"{ //read the inspection policy
+		return get_inspection_policy(stub)
+	} else if function == "issue_warranty"{    //attach a warranty to a marble
+		return issue_warranty(stub, args)
+	} else if function == "file_warranty_claim"{ //owner claims against a marble's warranty
+		return file_warranty_claim(stub, args)
+	} else if function == "resolve_claim"{     //warranty issuer approves or rejects a claim
+		return resolve_claim(stub, args)
+	} else if function == "get_warranty"{      //read a marble's warranty and claims
+		return get_warranty(stub, args)
+	} else if function == "notarize_document"{ //time stamp a document hash against a marble
+		return notarize_document(stub, args)
+	} else if function == "verify_document"{   //check a document hash was notarized for a marble
+		return verify_document(stub, args)
+	} else if function == "purge_owner_pii"{   //redact an owner's personal fields (admin)
+		return purge_owner_pii(stub, args)
+	} else if function == "set_velocity_rules"{ //configure transfer velocity limits (admin)
+		return set_velocity_rules(stub, args)
+	} else if function == "get_velocity_rules"{ //read transfer velocity limits
+		return get_velocity_rules(stub)
+	} else if function == "clear_flag"{        //clear a flagged marble or owner (compliance)
+		return clear_flag(stub, args)
+	} else if function == "get_compliance_report"{ //read flagged activity for a time range (compliance)
+		return get_compliance_report(stub, args)
+	} else if function == "set_rarity_cap"{    //set the mint cap of a rarity tier (admin)
+		return set_rarity_cap(stub, args)
+	} else if function == "get_rarity_caps"{   //read rarity tier mint caps and counts
+		return get_rarity_caps(stub)
+	} else if function == "get_marbles_by_rarity"{ //read all marbles of a rarity tier
+		return get_marbles_by_rarity(stub, args)
+	} else if function == "set_recipe"{        //create or replace a crafting recipe (admin)
+		return set_recipe(stub, args)
+	} else if function == "get_recipe"{        //read a crafting recipe
+		return get_recipe(stub, args)
+	} else if function == "craft"{             //burn input marbles to mint a recipe's output
+		return craft(stub, args)
+	} else if function == "get_badges"{        //read the badges an owner has earned
+		return get_badges(stub, args)
+	} else if function == "set_template"{      //create or replace a marble template (admin)
+		return set_template(stub, args)
+	} else if function == "get_template"{      //read a marble template
+		return get_template(stub, args)
+	} else if function == "init_marble_from_template"{ //create a new marble from a template
+		return init_marble_from_template(stub, args)
+	} else if function == "release_to_pool"{   //give a marble to the unowned pool
+		return release_to_pool(stub, args)
+	} else if function == "claim_from_pool"{   //take a marble from the unowned pool
+		return claim_from_pool(stub, args)
+	} else if function == "set_pool_cooldown"{ //limit how often an owner can claim from the pool (admin)
+		return set_pool_cooldown(stub, args)
+	} else if function == "get_operation"{     //read what a transaction did
+		return get_operation(stub, args)
+	} else if function == "compensate"{        //undo a prior transaction (admin)
+		return compensate(stub, args)
+	} else if function == "set_protected"{     //protect a marble from one step deletes
+		return set_protected(stub, args)
+	} else if function == "request_delete"{    //owner asks to delete a protected marble
+		return request_delete(stub, args)
+	} else if function == "approve_delete"{    //delete a protected marble after a request (admin)
+		return approve_delete(stub, args)
+	} else if function == "tag_marble"{        //add tags to a marble
+		return tag_marble(stub, args)
+	} else if function == "untag_marble"{      //remove tags from a marble
+		return untag_marble(stub, args)
+	} else if function == "get_marbles_by_tag"{ //read all marbles with a tag
+		return get_marbles_by_tag(stub, args)
+	} else if function == "set_metadata"{      //point a marble at its ERC-721 style metadata
+		return set_metadata(stub, args)
+	} else if function == "set_physical"{      //set a marble's weight and dimensions
+		return set_physical(stub, args)
+	} else if function == "set_allowed_units"{ //set the unit whitelist for weights or lengths (admin)
+		return set_allowed_units(stub, args)
+	} else if function == "get_allowed_units"{ //read the unit whitelists
+		return get_allowed_units(stub)
+	} else if function == "get_marbles_by_size_range"{ //read marbles between two sizes, in any allowed unit
+		return get_marbles_by_size_range(stub, args)
+	} else if function == "record_location"{   //log where a marble physically is
+		return record_location(stub, args)
+	} else if function == "get_location_history"{ //read every location logged for a marble
+		return get_location_history(stub, args)
+	} else if function == "set_description"{   //set a marble's description and notes
+		return set_description(stub, args)
+	} else if function == "search_text"{       //find marbles by words in their description or notes (couchdb only)
+		return search_text(stub, args)
+	} else if function == "get_recent_activity"{ //read the newest creates, transfers and deletes
+		return get_recent_activity(stub, args)
+	} else if function == "rebuild_indexes_from_state"{ //throw away and rebuild the rarity, tag and holdings indexes (admin)
+		return rebuild_indexes_from_state(stub)
+	} else if function == "set_size_bounds"{   //set the smallest and largest marble size allowed (admin)
+		return set_size_bounds(stub, args)
+	} else if function == "get_size_bounds"{   //read the marble size bounds
+		return get_size_bounds(stub)
+	} else if function == "watch"{             //get an event when a marble changes
+		return watch(stub, args)
+	} else if function == "unwatch"{           //stop watching a marble
+		return unwatch(stub, args)
+	} else if function == "get_watchlist"{     //read the marbles someone is watching
+		return get_watchlist(stub, args)
+	} else if function == "reconcile_ownership"{ //compare an external ownership snapshot to the ledger, optionally fix it (admin)
+		return reconcile_ownership(stub, args)
+	} else if function == "create_invites"{    //store one time invitation codes for init_owner (admin)
+		return create_invites(stub, args)
+	} else if function == "set_invites_required"{ //turn invitation gated registration on or off (admin)
+		return set_invites_required(stub, args)
+	} else if function == "set_daily_transfer_limit"{ //limit how many transfers an owner can send per day (admin)
+		return set_daily_transfer_limit(stub, args)
+	} else if function == "get_daily_transfer_limit"{ //read an owner's daily limit and how much of it is used today
+		return get_daily_transfer_limit(stub, args)
+	} else if function == "set_mint_quota"{    //limit how many marbles of a color an org can mint (admin)
+		return set_mint_quota(stub, args)
+	} else if function == "get_mint_quota"{    //read an org's mint quota for a color
+		return get_mint_quota(stub, args)
+	} else if function == "state_digest"{      //hash every document of a type, to compare peers
+		return state_digest(stub, args)
+	} else if function == "diff_marble"{       //show what changed in a marble between two transactions
+		return diff_marble(stub, args)
+	} else if function == "get_transfer_receipts"{ //read the receipt of every transfer of a marble
+		return get_transfer_receipts(stub, args)
+	} else if function == "set_max_results"{   //set the most results a list/query returns at once (admin)
+		return set_max_results(stub, args)
+	} else if function == "get_max_results"{   //read the result cap
+		return get_max_results(stub)
+	} else if function == "create_drop"{       //earmark marbles from a template for a launch (admin)
+		return create_drop(stub, args)
+	} else if function == "claim_drop"{        //mint a marble from a drop once it has started
+		return claim_drop(stub, args)
+	} else if function == "get_drop"{          //read a drop
+		return get_drop(stub, args)
+	} else if function == "set_nonce_required"{ //make an owner's signed payloads need a nonce, or not
+		return set_nonce_required(stub, args)
+	} else if function == "get_nonce"{         //read an owner's last nonce
+		return get_nonce(stub, args)
+	} else if function == "set_contact_info"{ //store an owner's contact details in a private collection
+		return set_contact_info(stub, args)
+	} else if function == "get_my_contact_info"{ //read an owner's contact details from the private collection
+		return get_my_contact_info(stub, args)
+	} else if function == "set_beneficiary"{   //name who inherits an owner's marbles after a period of inactivity
+		return set_beneficiary(stub, args)
+	} else if function == "check_in"{          //owner is still active, restart the inheritance clock
+		return check_in(stub, args)
+	} else if function == "claim_inheritance"{ //beneficiary takes an inactive owner's marbles
+		return claim_inheritance(stub, args)
+	} else if function == "get_beneficiary"{   //read an owner's beneficiary
+		return get_beneficiary(stub, args)
+	} else if function == "query_marbles_by_owner"{ //read an owner's marbles with a rich query (couchdb only)
+		return query_marbles_by_owner(stub, args)
+	} else if function == "create_desk"{       //create a trading desk owner
+		return create_desk(stub, args)
+	} else if function == "add_desk_member"{   //let an owner act for a desk
+		return add_desk_member(stub, args)
+	} else if function == "remove_desk_member"{ //stop an owner acting for a desk
+		return remove_desk_member(stub, args)
+	} else if function == "desk_transfer"{     //a desk member moves a desk marble
+		return desk_transfer(stub, args)
+	} else if function == "get_desk"{          //read a desk's members
+		return get_desk(stub, args)
+	} else if function == "get_desk_audit"{    //read the transfers a desk's members made
+		return get_desk_audit(stub, args)
+	} else if function == "list_marbles"{      //read every marble a page at a time
+		return list_marbles(stub, args)
+	} else if function == "get_marble_by_serial"{ //read a marble by its color and serial number
+		return get_marble_by_serial(stub, args)
+	} else if function == "register_doc_type"{ //add a doc type and its schema (admin)
+		return register_doc_type(stub, args)
+	} else if function == "get_doc_types"{     //read the built in and registered doc types
+		return get_doc_types(stub)
+	} else if function == "put_custom_doc"{    //store a doc of a registered doc type
+		return put_custom_doc(stub, args)
+	} else if function == "get_custom_doc"{    //read a doc of a registered doc type
+		return get_custom_doc(stub, args)
+	} else if function == "get_marble_history"{ //read a marble's provenance with timestamps and deletes
+		return get_marble_history(stub, args)
+	} else if function == "get_marble_by_fingerprint"{ //read the marble with a fingerprint
+		return get_marble_by_fingerprint(stub, args)
+	} else if function == "get_identity"{      //read the caller's identity fingerprint
+		return get_identity(stub)
+	} else if function == "set_owner_identity"{ //bind an owner to an identity (admin)
+		return set_owner_identity(stub, args)
+	} else if function == "grant_role"{        //give an invoker a role (admin)
+		return grant_role(stub, args)
+	} else if function == "revoke_role"{       //take a role from an invoker (admin)
+		return revoke_role(stub, args)
+	} else if function == "whoami"{            //read the invoker id of the caller
+		return whoami(stub)
+	} else if function == "pause"{             //block mutating functions (admin)
+		return pause(stub)
+	} else if function == "unpause"{           //allow mutating functions again (admin)
+		return unpause(stub)
 	}
 
 	// error out
 	fmt.Println("Received unknown invoke function name - " + function)
 	return shim.Error("Received unknown invoke function name - '" + function + "'")
 }
-
-
-// ============================================================================================================================
-// Query - legacy function
-// ============================================================================================================================
-func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface) pb.Response {
-	return shim.Error("Unknown supported call - Query()")
-}
@@ -0,0 +1,120 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Metadata Definitions - a marble can point at an ERC-721 metadata json (name, description, image) stored off chain
+//
+// The hash lets viewers check the json they fetched is the one the owner registered.
+// Every validator runs on set_metadata(), add to the list to tighten the rules for a deployment.
+// ============================================================================================================================
+const MAX_METADATA_URI_LENGTH = 256
+
+var metadata_uri_schemes = []string{"https://", "http://", "ipfs://", "ar://"}
+
+var metadata_validators = []func(uri string, hash string) error{
+	validate_metadata_uri,
+	validate_metadata_hash,
+}
+
+// ============================================================================================================================
+// Set Metadata - set a marble's metadata uri and hash
+//
+// Inputs - Array of Strings
+//       0     ,            1         ,         2       ,         3
+//  marble id  ,        metadata uri  ,   metadata hash ,  authing company
+// "m999999999", "ipfs://Qm.../1.json", "9f86d08188...", "united marbles"
+// ============================================================================================================================
+func set_metadata(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_metadata")
+
+	// input sanitation, the uri and hash are checked by the validators
+	err = sanitize_arguments([]string{args[0], args[3]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	uri := args[1]
+	hash := strings.ToLower(args[2])
+	authed_by_company := args[3]
+
+	for _, validate := range metadata_validators {
+		err = validate(uri, hash)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize metadata for '" + marble.Owner.Company + "'.")
+	}
+
+	marble.MetadataURI = uri
+	marble.MetadataHash = hash
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_metadata")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Metadata validators
+// ============================================================================================================================
+func validate_metadata_uri(uri string, hash string) error {
+	if len(uri) == 0 || len(uri) > MAX_METADATA_URI_LENGTH {
+		return errors.New("Metadata uri must be a non-empty string <= 256 characters")
+	}
+	for _, scheme := range metadata_uri_schemes {
+		if strings.HasPrefix(uri, scheme) {
+			return nil
+		}
+	}
+	return errors.New("Metadata uri must start with one of " + strings.Join(metadata_uri_schemes, ", "))
+}
+
+func validate_metadata_hash(uri string, hash string) error {
+	hashAsBytes, err := hex.DecodeString(hash)
+	if err != nil || len(hashAsBytes) != 32 {
+		return errors.New("Metadata hash must be a hex encoded sha256")
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Mint Quota Definitions - how many marbles of a color each organization (msp id of the caller) may mint
+//
+// Stored under composite key "mint_quota" [msp id, color]. No quota for an org + color means no limit,
+// a quota of 0 means that org can't mint that color at all.
+// ============================================================================================================================
+type MintQuota struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	MspId      string `json:"mspId"`
+	Color      string `json:"color"`
+	Quota      int    `json:"quota"`
+	Minted     int    `json:"minted"`
+}
+
+// ============================================================================================================================
+// Set Mint Quota - set an org's quota for a color, marbles already minted still count. Admin only
+//
+// Inputs - Array of Strings
+//       0   ,    1   ,   2
+//    msp id ,  color , quota
+//  "Org1MSP", "blue" , "100"
+// ============================================================================================================================
+func set_mint_quota(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_mint_quota")
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	quota, err := strconv.Atoi(args[2])
+	if err != nil || quota < 0 {
+		return shim.Error("3rd argument must be a non-negative numeric string")
+	}
+
+	mint_quota, _, err := get_mint_quota_doc(stub, args[0], normalize_name(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mint_quota.Quota = quota
+	err = put_mint_quota(stub, mint_quota)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_mint_quota")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Mint Quota - read an org's quota and minted count for a color
+//
+// Inputs - Array of Strings
+//       0   ,    1
+//    msp id ,  color
+//  "Org1MSP", "blue"
+// ============================================================================================================================
+func get_mint_quota(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	mint_quota, found, err := get_mint_quota_doc(stub, args[0], normalize_name(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("No mint quota for " + args[0] + " " + args[1] + ", minting is not limited")
+	}
+	quotaAsBytes, _ := json.Marshal(mint_quota)                  //convert to array of bytes
+	return shim.Success(quotaAsBytes)
+}
+
+// ============================================================================================================================
+// Mint Quota helpers
+// ============================================================================================================================
+
+// count a new marble against the caller's org quota for its color, errors if the quota is used up
+func use_mint_quota(stub shim.ChaincodeStubInterface, color string) error {
+	msp_id, err := get_invoker_msp(stub)
+	if err != nil {
+		return err
+	}
+	mint_quota, found, err := get_mint_quota_doc(stub, msp_id, color)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	if mint_quota.Minted >= mint_quota.Quota {
+		return errors.New(msp_id + " has used its quota of " + strconv.Itoa(mint_quota.Quota) + " " + color + " marbles")
+	}
+	mint_quota.Minted++
+	return put_mint_quota(stub, mint_quota)
+}
+
+// found is false if no quota was ever set, the returned doc is still filled in and ready to store
+func get_mint_quota_doc(stub shim.ChaincodeStubInterface, msp_id string, color string) (MintQuota, bool, error) {
+	var mint_quota MintQuota
+	key, err := stub.CreateCompositeKey("mint_quota", []string{msp_id, color})
+	if err != nil {
+		return mint_quota, false, err
+	}
+	quotaAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return mint_quota, false, errors.New("Failed to get mint quota")
+	}
+	if quotaAsBytes == nil {
+		mint_quota.ObjectType = "mint_quota"
+		mint_quota.MspId = msp_id
+		mint_quota.Color = color
+		return mint_quota, false, nil
+	}
+	json.Unmarshal(quotaAsBytes, &mint_quota)                    //un stringify it aka JSON.parse()
+	return mint_quota, true, nil
+}
+
+func put_mint_quota(stub shim.ChaincodeStubInterface, mint_quota MintQuota) error {
+	key, err := stub.CreateCompositeKey(mint_quota.ObjectType, []string{mint_quota.MspId, mint_quota.Color})
+	if err != nil {
+		return err
+	}
+	quotaAsBytes, _ := json.Marshal(mint_quota)                  //convert to array of bytes
+	return stub.PutState(key, quotaAsBytes)
+}
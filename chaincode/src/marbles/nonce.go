@@ -0,0 +1,173 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Nonce Definitions - a per owner counter that stops a signed payload from being submitted twice
+//
+// Every payload an owner signs with a nonce must use a bigger one than the last, so a relayer that kept a copy
+// can't submit it again later. Without one a signed transfer still only works once, its payload names the marble's
+// last tx (see set_owner_signed()). Kept apart from the owner doc so transfers that flag the owner can't write over it.
+// ============================================================================================================================
+type Nonce struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	OwnerId    string `json:"ownerId"`
+	Last       int64  `json:"last"`     //biggest nonce used so far, 0 is none
+	Required   bool   `json:"required"` //signed payloads without a nonce are refused
+}
+
+// ============================================================================================================================
+// Set Nonce Required - make an owner's signed payloads carry a nonce, or not
+//
+// Inputs - Array of Strings
+//           0     ,     1    ,         2
+//      owner id   , required ,  authing company
+// "o9999999999999",  "true"  , "united marbles"
+// ============================================================================================================================
+func set_nonce_required(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_nonce_required")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	required, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be true or false")
+	}
+	authed_by_company := args[2]
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize nonces for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can change its nonce setting
+	err = check_owner_identity(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	nonce, err := get_nonce_doc(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	nonce.Required = required
+	err = put_nonce(stub, nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_nonce_required")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Nonce - read an owner's last nonce, sign the next payload with anything bigger
+//
+// Inputs - Array of Strings
+//           0
+//      owner id
+// "o9999999999999"
+// ============================================================================================================================
+func get_nonce(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	nonce, err := get_nonce_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	nonceAsBytes, _ := json.Marshal(nonce)                       //convert to array of bytes
+	return shim.Success(nonceAsBytes)
+}
+
+// ============================================================================================================================
+// Nonce helpers
+// ============================================================================================================================
+
+// check and use up a nonce, an empty one is only ok if the owner doesn't require them
+func use_nonce(stub shim.ChaincodeStubInterface, owner_id string, value string) error {
+	nonce, err := get_nonce_doc(stub, owner_id)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		if nonce.Required {
+			return errors.New("Owner requires a nonce on signed payloads - " + owner_id)
+		}
+		return nil
+	}
+
+	next, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || next <= 0 {
+		return errors.New("Nonce must be a positive numeric string")
+	}
+	if next <= nonce.Last {
+		return errors.New("Nonce " + value + " already used, must be bigger than " + strconv.FormatInt(nonce.Last, 10))
+	}
+	nonce.Last = next
+	return put_nonce(stub, nonce)
+}
+
+func get_nonce_doc(stub shim.ChaincodeStubInterface, owner_id string) (Nonce, error) {
+	var nonce Nonce
+	key, err := stub.CreateCompositeKey("nonce", []string{owner_id})
+	if err != nil {
+		return nonce, err
+	}
+	nonceAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nonce, errors.New("Failed to get nonce")
+	}
+	if nonceAsBytes == nil {
+		nonce.ObjectType = "nonce"
+		nonce.OwnerId = owner_id
+		return nonce, nil
+	}
+	json.Unmarshal(nonceAsBytes, &nonce)                         //un stringify it aka JSON.parse()
+	return nonce, nil
+}
+
+func put_nonce(stub shim.ChaincodeStubInterface, nonce Nonce) error {
+	key, err := stub.CreateCompositeKey(nonce.ObjectType, []string{nonce.OwnerId})
+	if err != nil {
+		return err
+	}
+	nonceAsBytes, _ := json.Marshal(nonce)                       //convert to array of bytes
+	return stub.PutState(key, nonceAsBytes)
+}
@@ -0,0 +1,64 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ============================================================================================================================
+// Name Normalization - usernames, colors, rarities and tags are trimmed, put in unicode NFC form and lower cased
+//
+// NFC makes an "é" typed as one code point equal to one typed as "e" plus an accent.
+// Usernames are also indexed per company (composite key "username" [company, username]) so two owners
+// can't end up with the same normalized name.
+// ============================================================================================================================
+func normalize_name(name string) string {
+	return strings.ToLower(norm.NFC.String(strings.TrimSpace(name)))
+}
+
+// claim the owner's username at their company, errors if someone else has it
+func index_username(stub shim.ChaincodeStubInterface, owner Owner) error {
+	key, err := stub.CreateCompositeKey("username", []string{owner.Company, owner.Username})
+	if err != nil {
+		return err
+	}
+	takenAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return errors.New("Failed to get username index")
+	}
+	if takenAsBytes != nil && string(takenAsBytes) != owner.Id {
+		return errors.New("Username '" + owner.Username + "' is already taken at '" + owner.Company + "' by " + string(takenAsBytes))
+	}
+	return stub.PutState(key, []byte(owner.Id))
+}
+
+func unindex_username(stub shim.ChaincodeStubInterface, owner Owner) error {
+	key, err := stub.CreateCompositeKey("username", []string{owner.Company, owner.Username})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
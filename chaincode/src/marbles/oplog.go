@@ -0,0 +1,450 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Operation Log ----- //
+// one per successful mutating transaction, stored under composite key "op~txid"
+//
+// Each owner whose record or marbles it changed gets an "op~owner" [owner id, tx id] key, so purge_owner_pii() only
+// reads that owner's operations. An operation over the caps below keeps no before values (and past MAX_OP_KEYS no key
+// lists either); rebuild_indexes_from_state() and the like would write multi MB entries otherwise. Those can't be
+// compensated.
+const MAX_OP_KEYS = 1000                                         //keys listed per operation
+const MAX_OP_BEFORE_BYTES = 64 * 1024                            //before values kept per operation
+
+type Operation struct {
+	ObjectType    string      `json:"docType"` //field for couchdb
+	TxId          string      `json:"txId"`
+	Function      string      `json:"function"`
+	ArgsDigest    string      `json:"argsDigest"` //sha256 of the args, the args themselves can be large or sensitive
+	AffectedKeys  []string    `json:"affectedKeys"`
+	Changes       []KeyChange `json:"changes"` //what compensate() needs to undo this operation
+	Invoker       string      `json:"invoker"`
+	Timestamp     int64       `json:"timestamp"`               //ms, tx time
+	CompensatedBy string      `json:"compensatedBy,omitempty"` //tx id of the compensate call that undid this
+	KeyCount      int         `json:"keyCount"`
+	Truncated     bool        `json:"truncated,omitempty"` //over a cap, see MAX_OP_KEYS and MAX_OP_BEFORE_BYTES
+}
+
+type KeyChange struct {
+	Key       string `json:"key"`
+	Existed   bool   `json:"existed"`            //false if the key was created by this operation
+	Before    []byte `json:"before,omitempty"`   //value before the operation
+	AfterHash string `json:"afterHash"`          //sha256 of the value after, empty if it was deleted
+	Scrubbed  bool   `json:"scrubbed,omitempty"` //before was dropped by purge_owner_pii(), can't be compensated
+}
+
+// these log no before values and only hashes of their keys, they exist to remove data, so there's nothing to undo
+var uncompensatable_functions = map[string]bool{
+	"purge_owner_pii": true,
+}
+
+// ============================================================================================================================
+// Op Recorder - wraps the stub handed to a handler and remembers every key it writes or deletes
+//
+// The peer's GetState() only sees committed state, so a counter bumped twice in one tx would only go up by one.
+// Reads through the recorder see the handler's own writes instead. Range and rich queries still only see committed state.
+// It holds on to the handler's events too, see flush_events().
+// ============================================================================================================================
+type op_recorder struct {
+	shim.ChaincodeStubInterface
+	keys    []string
+	changes map[string]*KeyChange
+	values  map[string][]byte //what this tx wrote, nil if it deleted the key
+	events  []ChaincodeEvent
+}
+
+func (r *op_recorder) GetState(key string) ([]byte, error) {
+	value, written := r.values[key]
+	if written {
+		return value, nil
+	}
+	return r.ChaincodeStubInterface.GetState(key)
+}
+
+func (r *op_recorder) PutState(key string, value []byte) error {
+	err := r.record(key, value)
+	if err != nil {
+		return err
+	}
+	return r.ChaincodeStubInterface.PutState(key, value)
+}
+
+func (r *op_recorder) DelState(key string) error {
+	err := r.record(key, nil)
+	if err != nil {
+		return err
+	}
+	return r.ChaincodeStubInterface.DelState(key)
+}
+
+func (r *op_recorder) SetEvent(name string, payload []byte) error {
+	r.events = append(r.events, ChaincodeEvent{Name: name, Payload: json.RawMessage(payload)})
+	return nil
+}
+
+// the first touch of a key grabs its before value, the peer's GetState() only sees committed state so that's what we want
+func (r *op_recorder) record(key string, value []byte) error {
+	if r.changes == nil {
+		r.changes = map[string]*KeyChange{}
+		r.values = map[string][]byte{}
+	}
+	change, found := r.changes[key]
+	if !found {
+		before, err := r.ChaincodeStubInterface.GetState(key)
+		if err != nil {
+			return err
+		}
+		change = &KeyChange{Key: key, Existed: before != nil, Before: before}
+		r.changes[key] = change
+		r.keys = append(r.keys, key)
+	}
+	change.AfterHash = hash_value(value)
+	r.values[key] = value
+	return nil
+}
+
+func (r *op_recorder) key_changes() []KeyChange {
+	changes := []KeyChange{}
+	for _, key := range r.keys {                                 //keys keeps the order, the map does not
+		changes = append(changes, *r.changes[key])
+	}
+	return changes
+}
+
+func hash_value(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	valueHash := sha256.Sum256(value)
+	return hex.EncodeToString(valueHash[:])
+}
+
+// ============================================================================================================================
+// Put Operation - store the operation log for this transaction
+// ============================================================================================================================
+func put_operation(stub shim.ChaincodeStubInterface, function string, args []string, recorder *op_recorder) error {
+	var op Operation
+	var err error
+	op.ObjectType = "operation"
+	op.TxId = stub.GetTxID()
+	op.Function = function
+	op.AffectedKeys = recorder.keys
+	if op.AffectedKeys == nil {
+		op.AffectedKeys = []string{}
+	}
+	op.Changes = recorder.key_changes()
+	if uncompensatable_functions[function] {                     //the keys themselves can hold PII, eg the username index
+		hashed := []string{}
+		for _, key := range op.AffectedKeys {
+			hashed = append(hashed, hash_value([]byte(key)))
+		}
+		op.AffectedKeys = hashed
+		op.Changes = []KeyChange{}
+	}
+	op.KeyCount = len(op.AffectedKeys)
+	if op.KeyCount > MAX_OP_KEYS {
+		op.AffectedKeys = []string{}
+		op.Changes = []KeyChange{}
+		op.Truncated = true
+	}
+	before_bytes := 0
+	for _, change := range op.Changes {
+		before_bytes += len(change.Before)
+	}
+	if before_bytes > MAX_OP_BEFORE_BYTES {
+		for i := range op.Changes {
+			op.Changes[i].Before = nil
+		}
+		op.Truncated = true
+	}
+
+	argsHash := sha256.Sum256([]byte(strings.Join(args, "\x00"))) //null separated so ["ab","c"] != ["a","bc"]
+	op.ArgsDigest = hex.EncodeToString(argsHash[:])
+
+	op.Invoker, err = get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	op.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+
+	err = store_operation(stub, op)
+	if err != nil {
+		return err
+	}
+	if len(op.AffectedKeys) == 0 || uncompensatable_functions[function] {  //no keys, nothing for a purge to scrub
+		return nil
+	}
+	return index_operation_owners(stub, op.TxId, recorder)
+}
+
+// an "op~owner" key for every owner whose record or marble the operation touched, before or after
+func index_operation_owners(stub shim.ChaincodeStubInterface, txid string, recorder *op_recorder) error {
+	owner_ids := map[string]bool{}
+	for _, key := range recorder.keys {
+		for _, value := range [][]byte{recorder.changes[key].Before, recorder.values[key]} {
+			owner_id := owner_of(value)
+			if len(owner_id) > 0 {
+				owner_ids[owner_id] = true
+			}
+		}
+	}
+	for owner_id := range owner_ids {
+		key, err := stub.CreateCompositeKey("op~owner", []string{owner_id, txid})
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(key, []byte{0x00})                   //the key is the index, value just can't be nil
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the owner id of an owner record or the holder of a marble, empty for anything else
+func owner_of(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	var doc struct {
+		ObjectType string `json:"docType"`
+		Id         string `json:"id"`
+		Owner      struct {
+			Id string `json:"id"`
+		} `json:"owner"`
+	}
+	json.Unmarshal(value, &doc)                                  //un stringify it aka JSON.parse()
+	if doc.ObjectType == "marble_owner" {
+		return doc.Id
+	}
+	if doc.ObjectType == "marble" {
+		return doc.Owner.Id
+	}
+	return ""
+}
+
+func store_operation(stub shim.ChaincodeStubInterface, op Operation) error {
+	key, err := stub.CreateCompositeKey("op~txid", []string{op.TxId})
+	if err != nil {
+		return err
+	}
+	opAsBytes, _ := json.Marshal(op)                             //convert to array of bytes
+	return stub.PutState(key, opAsBytes)
+}
+
+func get_operation_doc(stub shim.ChaincodeStubInterface, txid string) (Operation, error) {
+	var op Operation
+	key, err := stub.CreateCompositeKey("op~txid", []string{txid})
+	if err != nil {
+		return op, err
+	}
+	opAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return op, errors.New("Failed to get operation")
+	}
+	json.Unmarshal(opAsBytes, &op)                               //un stringify it aka JSON.parse()
+	if op.TxId != txid {                                         //test if operation is actually here or just nil
+		return op, errors.New("No operation logged for tx - " + txid)
+	}
+	return op, nil
+}
+
+// ============================================================================================================================
+// Compensate - undo a prior transaction by putting every key it changed back how it was. Admin only
+//
+// Only works if none of those keys changed since, otherwise the undo would clobber newer writes.
+// Purges can't be undone, and neither can anything whose before values a purge scrubbed.
+// This call gets its own operation log like any other, and the original is marked with this tx id.
+//
+// Inputs - Array of Strings
+//     0
+//   tx id
+//  "2b2d7c4c..."
+// ============================================================================================================================
+func compensate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting compensate")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	op, err := get_operation_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(op.CompensatedBy) > 0 {
+		return shim.Error("Transaction was already compensated by " + op.CompensatedBy)
+	}
+	if uncompensatable_functions[op.Function] {
+		return shim.Error("Transactions of " + op.Function + " cannot be compensated")
+	}
+	if op.Truncated {
+		return shim.Error("Transaction " + op.TxId + " was too big to log in full, it cannot be compensated")
+	}
+	for _, change := range op.Changes {
+		if change.Scrubbed {
+			return shim.Error("Transaction " + op.TxId + " touched purged owner data, it cannot be compensated")
+		}
+	}
+
+	// make sure nothing moved on since
+	for _, change := range op.Changes {
+		currentAsBytes, err := stub.GetState(change.Key)
+		if err != nil {
+			return shim.Error("Failed to get state for " + change.Key)
+		}
+		if hash_value(currentAsBytes) != change.AfterHash {
+			return shim.Error("Key '" + change.Key + "' changed after tx " + op.TxId + ", cannot compensate")
+		}
+	}
+
+	// put it all back
+	for _, change := range op.Changes {
+		if change.Existed {
+			err = stub.PutState(change.Key, change.Before)
+		} else {
+			err = stub.DelState(change.Key)
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	op.CompensatedBy = stub.GetTxID()
+	err = store_operation(stub, op)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end compensate")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Operation - read the operation log of a transaction. Support role only, the before values can hold owner details
+//
+// Inputs - Array of Strings
+//     0
+//   tx id
+//  "2b2d7c4c..."
+// ============================================================================================================================
+func get_operation(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	err := check_role(stub, "support")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := stub.CreateCompositeKey("op~txid", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	opAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get operation")
+	}
+	if opAsBytes == nil {
+		return shim.Error("No operation logged for tx - " + args[0])
+	}
+	return shim.Success(opAsBytes)
+}
+
+// ============================================================================================================================
+// Scrub Operations - drop an owner's details from every operation log, for purge_owner_pii()
+//
+// Changes to the owner record, to keys that hold its username and to marbles it held lose their before values.
+// Keys that hold the username are replaced too. Scrubbed changes can't be compensated. Only the owners' operations
+// are read, found by their "op~owner" keys.
+// ============================================================================================================================
+func scrub_operations(stub shim.ChaincodeStubInterface, owner_ids map[string]bool, pii_keys map[string]bool) error {
+	txids := []string{}
+	for owner_id := range owner_ids {
+		ids, err := get_index_ids(stub, "op~owner", owner_id)
+		if err != nil {
+			return err
+		}
+		txids = append(txids, ids...)
+	}
+	sort.Strings(txids)                                          //map order is random, every peer must write the same
+
+	for n, txid := range txids {
+		if n > 0 && txids[n - 1] == txid {                        //an op can touch several of the owners
+			continue
+		}
+		op, err := get_operation_doc(stub, txid)
+		if err != nil {
+			return err
+		}
+
+		scrubbed := false
+		for i, change := range op.Changes {
+			if change.Scrubbed || !(owner_ids[change.Key] || pii_keys[change.Key] || held_by(change.Before, owner_ids)) {
+				continue
+			}
+			op.Changes[i].Before = nil
+			op.Changes[i].Scrubbed = true
+			if pii_keys[change.Key] {
+				op.Changes[i].Key = REDACTED
+			}
+			scrubbed = true
+		}
+		for i, key := range op.AffectedKeys {
+			if pii_keys[key] {
+				op.AffectedKeys[i] = REDACTED
+				scrubbed = true
+			}
+		}
+		if scrubbed {
+			err = store_operation(stub, op)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// true if the value is a marble held by one of the owners
+func held_by(value []byte, owner_ids map[string]bool) bool {
+	if value == nil {
+		return false
+	}
+	var marble Marble
+	json.Unmarshal(value, &marble)                               //un stringify it aka JSON.parse()
+	return marble.ObjectType == "marble" && owner_ids[marble.Owner.Id]
+}
@@ -0,0 +1,106 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func (s *test_stub) last_txid() string {
+	return "tx" + strconv.Itoa(s.txs)
+}
+
+func TestPurgeLeavesNoCopiesInOperationLogs(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	bob := new_identity(t, "Org1MSP", "bob")
+	alice := new_identity(t, "Org1MSP", "alice")
+	stub.must(t, bob, "init_owner", "o1", "Bob", COMPANY)
+	stub.must(t, alice, "init_owner", "o2", "alice", COMPANY)
+	stub.must(t, bob, "init_marble", "m1", "blue", "35", "o1", COMPANY)
+	stub.must(t, bob, "init_marble", "m2", "red", "35", "o1", COMPANY)
+	stub.must(t, bob, "set_owner", "m1", "o2", COMPANY)          //before value of this one has bob on it
+	transfer_txid := stub.last_txid()
+
+	stub.must(t, admin, "purge_owner_pii", "o1")
+	purge_txid := stub.last_txid()
+
+	for key, value := range stub.State {
+		if strings.Contains(strings.ToLower(key), "bob") || strings.Contains(strings.ToLower(string(value)), "bob") {
+			t.Fatalf("bob is still in key %q - %s", key, value)
+		}
+	}
+
+	var op Operation
+	json.Unmarshal(stub.must(t, admin, "get_operation", transfer_txid).Payload, &op)
+	if len(op.Changes) == 0 {
+		t.Fatal("transfer op lost its changes")
+	}
+
+	stub.must_fail(t, admin, "compensate", purge_txid)
+	stub.must_fail(t, admin, "compensate", transfer_txid)
+	if stub.marble(t, "m2").Owner.Username != REDACTED {
+		t.Fatal("purge was undone")
+	}
+}
+
+func TestGetOperationNeedsSupportRole(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	alice := new_identity(t, "Org1MSP", "alice")
+	carol := new_identity(t, "Org1MSP", "carol")
+	stub.must(t, alice, "init_owner", "o1", "alice", COMPANY)
+	txid := stub.last_txid()
+
+	stub.must_fail(t, alice, "get_operation", txid)
+	stub.must_fail(t, carol, "get_operation", txid)
+	stub.must(t, admin, "grant_role", "support", string(stub.must(t, carol, "whoami").Payload))
+	stub.must(t, carol, "get_operation", txid)
+	stub.must(t, admin, "get_operation", txid)
+}
+
+func TestBigOperationsAreTruncated(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	stub.creator = admin
+	stub.start()
+	recorder := &op_recorder{ChaincodeStubInterface: stub}
+	for i := 0; i <= MAX_OP_KEYS; i++ {
+		recorder.PutState("k" + strconv.Itoa(i), []byte("v"))
+	}
+	err := put_operation(stub, "rebuild_indexes_from_state", []string{}, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.end(shim.Success(nil))
+	txid := stub.last_txid()
+
+	op, err := get_operation_doc(stub, txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !op.Truncated || op.KeyCount != MAX_OP_KEYS + 1 || len(op.Changes) > 0 || len(op.AffectedKeys) > 0 {
+		t.Fatalf("op should only keep its key count - %+v", op)
+	}
+	stub.must_fail(t, admin, "compensate", txid)
+}
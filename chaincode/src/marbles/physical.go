@@ -0,0 +1,320 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Physical Definitions - weight and dimensions as entered, plus normalized copies (grams and mm) for comparing
+//
+// Units must be known (so we can normalize them) and on the deployment's whitelist.
+// ============================================================================================================================
+const ALLOWED_UNITS_KEY = "_allowed_units"
+
+type Physical struct {
+	Weight      float64 `json:"weight"`
+	WeightUnit  string  `json:"weightUnit"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	LengthUnit  string  `json:"lengthUnit"`
+	WeightGrams float64 `json:"weightGrams"` //normalized
+	LargestMm   float64 `json:"largestMm"`   //normalized, the largest of length/width/height
+}
+
+// how many grams/mm in one of each unit we know about
+var weight_units = map[string]float64{"mg": 0.001, "g": 1, "kg": 1000, "oz": 28.349523125, "lb": 453.59237}
+var length_units = map[string]float64{"mm": 1, "cm": 10, "m": 1000, "in": 25.4}
+
+// used until an admin changes them with set_allowed_units()
+var default_allowed_units = map[string][]string{
+	"weight": {"g", "kg", "oz", "lb"},
+	"length": {"mm", "cm", "in"},
+}
+
+// ============================================================================================================================
+// Set Physical - set a marble's weight and dimensions
+//
+// This also sets the marble's fingerprint, see fingerprint.go.
+//
+// Inputs - Array of Strings
+//       0     ,    1   ,      2     ,    3   ,   4  ,    5   ,     6      ,         7
+//  marble id  , weight , weight unit, length , width, height , length unit,  authing company
+// "m999999999",  "5.2" ,     "g"    ,  "16"  , "16" ,  "16"  ,    "mm"    , "united marbles"
+// ============================================================================================================================
+func set_physical(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_physical")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[7]
+
+	physical, err := parse_physical(stub, args[1:7])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize changes for '" + marble.Owner.Company + "'.")
+	}
+
+	marble.Physical = &physical
+	err = claim_fingerprint(stub, &marble)                       //errors if this describes a marble we already have
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_physical")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Allowed Units - replace the whitelist for weights or lengths. Admin only
+//
+// Inputs - Array of Strings
+//      0    ,  1...
+//    kind   , units
+//  "weight" , "g", "kg"
+// ============================================================================================================================
+func set_allowed_units(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_allowed_units")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	kind := args[0]
+	units := args[1:]
+	known := weight_units
+	if kind == "length" {
+		known = length_units
+	} else if kind != "weight" {
+		return shim.Error("Kind must be 'weight' or 'length'")
+	}
+	for _, unit := range units {
+		if _, ok := known[unit]; !ok {
+			return shim.Error("Unknown " + kind + " unit - " + unit)
+		}
+	}
+
+	allowed, err := get_allowed_units_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowed[kind] = units
+	allowedAsBytes, _ := json.Marshal(allowed)                   //convert to array of bytes
+	err = stub.PutState(ALLOWED_UNITS_KEY, allowedAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_allowed_units")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Allowed Units - read the unit whitelists
+//
+// Inputs - none
+// ============================================================================================================================
+func get_allowed_units(stub shim.ChaincodeStubInterface) pb.Response {
+	allowed, err := get_allowed_units_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowedAsBytes, _ := json.Marshal(allowed)                   //convert to array of bytes
+	return shim.Success(allowedAsBytes)
+}
+
+// ============================================================================================================================
+// Get Marbles By Size Range - read marbles whose size falls in a range, compared in mm
+//
+// Marbles with dimensions use their largest dimension, the rest use their size field (which is mm).
+// Up to the result cap, if it's cut short pass the bookmark back to get the rest.
+//
+// Inputs - Array of Strings
+//    0  ,  1  ,   2  ,   3 (optional)
+//   min , max , unit ,    bookmark
+//   "1" , "2" , "cm" , "m999999999"
+// ============================================================================================================================
+func get_marbles_by_size_range(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var marbles []Marble
+	var err error
+
+	min, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return shim.Error("1st argument must be a numeric string")
+	}
+	max, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return shim.Error("2nd argument must be a numeric string")
+	}
+	allowed, err := get_allowed_units_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	minMm, err := to_base_unit(min, args[2], length_units, allowed["length"])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	maxMm, _ := to_base_unit(max, args[2], length_units, allowed["length"])
+	bookmark := ""
+	if len(args) == 4 {
+		bookmark = args[3]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(queryResponse.Key) {
+			continue
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+
+		sizeMm := float64(marble.Size)
+		if marble.Physical != nil {
+			sizeMm = marble.Physical.LargestMm
+		}
+		if sizeMm >= minMm && sizeMm <= maxMm {
+			if results.full(queryResponse.Key) {
+				break
+			}
+			marbles = append(marbles, marble)
+		}
+	}
+
+	return results.response(marbles)
+}
+
+// ============================================================================================================================
+// Physical helpers
+// ============================================================================================================================
+func get_allowed_units_config(stub shim.ChaincodeStubInterface) (map[string][]string, error) {
+	allowed := map[string][]string{}
+	for kind, units := range default_allowed_units {             //copy, so callers can't change the defaults
+		allowed[kind] = units
+	}
+	allowedAsBytes, err := stub.GetState(ALLOWED_UNITS_KEY)
+	if err != nil {
+		return allowed, errors.New("Failed to get allowed units")
+	}
+	if allowedAsBytes == nil {
+		return allowed, nil
+	}
+	err = json.Unmarshal(allowedAsBytes, &allowed)               //stored whitelists override the defaults
+	if err != nil {
+		return allowed, errors.New("Failed to parse allowed units")
+	}
+	return allowed, nil
+}
+
+// convert a value to grams/mm, the unit must be whitelisted
+// weight, weight unit, length, width, height, length unit - as set_physical() and init_marble() take them
+func parse_physical(stub shim.ChaincodeStubInterface, args []string) (Physical, error) {
+	var physical Physical
+	var err error
+
+	// parse the numbers
+	values := make([]float64, 4)
+	for i, arg := range []string{args[0], args[2], args[3], args[4]} {
+		values[i], err = strconv.ParseFloat(arg, 64)
+		if err != nil || values[i] <= 0 {
+			return physical, errors.New("Weight and dimensions must be positive numeric strings")
+		}
+	}
+	physical.Weight, physical.Length, physical.Width, physical.Height = values[0], values[1], values[2], values[3]
+	physical.WeightUnit = args[1]
+	physical.LengthUnit = args[5]
+
+	// check and normalize the units
+	allowed, err := get_allowed_units_config(stub)
+	if err != nil {
+		return physical, err
+	}
+	grams, err := to_base_unit(physical.Weight, physical.WeightUnit, weight_units, allowed["weight"])
+	if err != nil {
+		return physical, err
+	}
+	largest := physical.Length
+	if physical.Width > largest {
+		largest = physical.Width
+	}
+	if physical.Height > largest {
+		largest = physical.Height
+	}
+	mm, err := to_base_unit(largest, physical.LengthUnit, length_units, allowed["length"])
+	if err != nil {
+		return physical, err
+	}
+	physical.WeightGrams = grams
+	physical.LargestMm = mm
+	return physical, nil
+}
+
+func to_base_unit(value float64, unit string, known map[string]float64, allowed []string) (float64, error) {
+	if !contains(allowed, unit) {
+		return 0, errors.New("Unit is not allowed - " + unit)
+	}
+	factor, ok := known[unit]
+	if !ok {
+		return 0, errors.New("Unknown unit - " + unit)
+	}
+	return value * factor, nil
+}
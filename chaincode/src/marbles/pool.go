@@ -0,0 +1,248 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Pool Definitions - a system owner that holds unassigned marbles, anyone can claim them
+//
+// The pool owner has no company. Every authed_by_company argument is sanitized to be non-empty,
+// so no company check can ever pass for a pool marble, claim_from_pool() is the only way out.
+// Init() creates it and its id is reserved, so nobody can register the pool's id as their own owner first.
+// ============================================================================================================================
+const POOL_OWNER_ID = "o0000000000000pool"
+const POOL_COOLDOWN_KEY = "_pool_cooldown"
+
+// ============================================================================================================================
+// Release To Pool - the owner gives up a marble, it goes to the pool
+//
+// Inputs - Array of Strings
+//       0     ,         1
+//  marble id  ,  authing company
+// "m999999999", "united marbles"
+// ============================================================================================================================
+func release_to_pool(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting release_to_pool")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[1]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can give it away
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	pool, err := get_pool_owner(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = transfer_marble(stub, &marble, pool)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end release_to_pool")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Claim From Pool - take a marble out of the pool, limited by the pool cooldown if one is set
+//
+// Inputs - Array of Strings
+//       0     ,        1        ,         2
+//  marble id  ,     owner id    ,  authing company
+// "m999999999", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func claim_from_pool(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting claim_from_pool")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	owner_id := args[1]
+	authed_by_company := args[2]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Id != POOL_OWNER_ID {
+		return shim.Error("Marble is not in the pool - " + marble_id)
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize claims for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can claim for it
+	err = check_owner_identity(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// rate limit
+	cooldown, err := get_pool_cooldown(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimKey, err := stub.CreateCompositeKey("pool_claim", []string{owner_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	lastAsBytes, err := stub.GetState(claimKey)
+	if err != nil {
+		return shim.Error("Failed to get last pool claim")
+	}
+	if cooldown > 0 && lastAsBytes != nil {
+		last, _ := strconv.ParseInt(string(lastAsBytes), 10, 64)
+		if now - last < cooldown {
+			return shim.Error("Owner claimed from the pool too recently, try again after " + strconv.FormatInt(last + cooldown, 10))
+		}
+	}
+	err = stub.PutState(claimKey, []byte(strconv.FormatInt(now, 10)))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = move_marble(stub, &marble, owner)                       //skips the pool check in transfer_marble()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end claim_from_pool")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Pool Cooldown - how long an owner must wait between pool claims, 0 is no limit. Admin only
+//
+// Inputs - Array of Strings
+//       0
+//  cooldown ms
+//   "60000"
+// ============================================================================================================================
+func set_pool_cooldown(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting set_pool_cooldown")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	cooldown, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || cooldown < 0 {
+		return shim.Error("1st argument must be a non-negative numeric string")
+	}
+	err = stub.PutState(POOL_COOLDOWN_KEY, []byte(strconv.FormatInt(cooldown, 10)))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_pool_cooldown")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Pool helpers
+// ============================================================================================================================
+
+// get the pool owner, creating it the first time its needed
+func get_pool_owner(stub shim.ChaincodeStubInterface) (Owner, error) {
+	pool, err := get_owner(stub, POOL_OWNER_ID)
+	if err == nil && len(pool.Company) == 0 && len(pool.Identity) == 0 {
+		return pool, nil
+	}
+	if err == nil {                                              //someone registered the id before it was reserved, take it back
+		err = unindex_username(stub, pool)
+		if err != nil {
+			return pool, err
+		}
+		pool = Owner{}
+	}
+
+	pool.ObjectType = "marble_owner"
+	pool.Id = POOL_OWNER_ID
+	pool.Username = "pool"
+	pool.Company = ""                                            //on purpose, see Pool Definitions
+	err = put_owner(stub, pool)
+	if err != nil {
+		return pool, errors.New("Failed to create pool owner")
+	}
+	return pool, nil
+}
+
+// owner ids nobody can register
+func check_owner_id_allowed(owner_id string) error {
+	if owner_id == POOL_OWNER_ID {
+		return errors.New("Owner id is reserved for the pool - " + owner_id)
+	}
+	return nil
+}
+
+func get_pool_cooldown(stub shim.ChaincodeStubInterface) (int64, error) {
+	cooldownAsBytes, err := stub.GetState(POOL_COOLDOWN_KEY)
+	if err != nil {
+		return 0, errors.New("Failed to get pool cooldown")
+	}
+	if cooldownAsBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(cooldownAsBytes), 10, 64)
+}
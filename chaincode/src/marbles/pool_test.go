@@ -0,0 +1,60 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPoolOwnerIdIsReserved(t *testing.T) {
+	stub, admin, _, mallory := new_identity_fixture(t)
+
+	stub.must_fail(t, mallory, "init_owner", POOL_OWNER_ID, "pool", COMPANY)
+	stub.must_fail(t, admin, "init_owners_bulk", `[{"id":"`+POOL_OWNER_ID+`","username":"pool","company":"`+COMPANY+`"}]`)
+	stub.must_fail(t, mallory, "create_desk", POOL_OWNER_ID, "pool", COMPANY)
+
+	var pool Owner
+	json.Unmarshal(stub.State[POOL_OWNER_ID], &pool)            //Init() made it
+	if pool.Id != POOL_OWNER_ID || len(pool.Company) > 0 || len(pool.Identity) > 0 {
+		t.Fatalf("pool owner not set up by init - %+v", pool)
+	}
+}
+
+func TestSquattedPoolOwnerIsTakenBack(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+
+	// a ledger from before the id was reserved, mallory registered it
+	mallory_identity := string(stub.must(t, mallory, "get_identity").Payload)
+	squat, _ := json.Marshal(Owner{ObjectType: "marble_owner", Id: POOL_OWNER_ID, Username: "pool", Company: COMPANY, Identity: mallory_identity})
+	stub.State[POOL_OWNER_ID] = squat
+
+	stub.must(t, alice, "release_to_pool", "m1", COMPANY)
+	stub.must_fail(t, mallory, "set_owner", "m1", "o2", COMPANY)
+	if stub.marble(t, "m1").Owner.Id != POOL_OWNER_ID {
+		t.Fatal("marble should be in the pool")
+	}
+	var pool Owner
+	json.Unmarshal(stub.State[POOL_OWNER_ID], &pool)
+	if len(pool.Company) > 0 || len(pool.Identity) > 0 {
+		t.Fatalf("pool owner still squatted - %+v", pool)
+	}
+}
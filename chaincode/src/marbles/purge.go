@@ -0,0 +1,127 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+const REDACTED = "[redacted]"
+
+// ============================================================================================================================
+// Purge Owner PII - redact an owner's personal fields for right to erasure requests. Admin only
+//
+// The owner keeps its id so marbles, claims, etc. still point at it. The username is replaced everywhere it
+// was copied (the owner record and the owner relation on its marbles), its private contact info is deleted, and the
+// operation logs lose their copies (see scrub_operations()). Note the ledger history of those keys still holds the old
+// values, the world state is all chaincode can change.
+//
+// Inputs - Array of Strings
+//      0
+//   owner id
+// "o9999999999999"
+// ============================================================================================================================
+func purge_owner_pii(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting purge_owner_pii")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ---- Redact The Owner ---- //
+	owner, err := get_owner(stub, args[0])                       //by id, usernames are only unique within a company
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owner.Username == REDACTED {
+		return shim.Error("Owner was already purged - " + owner.Id)
+	}
+
+	err = unindex_username(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	usernameKey, err := stub.CreateCompositeKey("username", []string{owner.Company, owner.Username})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pii_keys := map[string]bool{usernameKey: true}
+	owner_ids := map[string]bool{owner.Id: true}
+	owner.Username = REDACTED
+	owner.PublicKey = ""
+	owner.Identity = ""                                          //hashed from the cert subject, an admin can bind a new one
+	err = put_owner(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ---- Redact Marble Owner Relations ---- //
+	marblesIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer marblesIterator.Close()
+
+	for marblesIterator.HasNext() {
+		queryResponse, err := marblesIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		if !owner_ids[marble.Owner.Id] {
+			continue
+		}
+
+		marble.Owner.Username = REDACTED
+		err = put_marble(stub, marble)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// ---- Drop Contact Info ---- //
+	err = delete_contact_info(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ---- Scrub Operation Logs ---- //
+	err = scrub_operations(stub, owner_ids, pii_keys)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end purge_owner_pii")
+	return shim.Success(nil)
+}
@@ -0,0 +1,69 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestPurgeLeavesOtherCompaniesAlone(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	bob := new_identity(t, "Org1MSP", "bob")
+	other_bob := new_identity(t, "Org2MSP", "bob")
+	stub.must(t, bob, "init_owner", "o1", "bob", COMPANY)
+	stub.must(t, other_bob, "init_owner", "o2", "bob", "other marbles")
+	stub.must(t, other_bob, "init_marble", "m2", "red", "35", "o2", "other marbles")
+
+	stub.must(t, admin, "purge_owner_pii", "o1")
+	stub.must_fail(t, admin, "purge_owner_pii", "o1")            //nothing left to purge
+
+	var owner Owner
+	json.Unmarshal(stub.State["o1"], &owner)                     //un stringify it aka JSON.parse()
+	if owner.Username != REDACTED {
+		t.Fatalf("o1 should be purged - %+v", owner)
+	}
+	json.Unmarshal(stub.State["o2"], &owner)
+	if owner.Username != "bob" || len(owner.Identity) == 0 {
+		t.Fatalf("the other company's bob should be untouched - %+v", owner)
+	}
+	if stub.marble(t, "m2").Owner.Username != "bob" {
+		t.Fatal("the other company's bob lost their name on m2")
+	}
+}
+
+func TestPurgeOnlyReadsTheOwnersOperations(t *testing.T) {
+	stub, admin := new_test_stub(t)
+	bob := new_identity(t, "Org1MSP", "bob")
+	alice := new_identity(t, "Org1MSP", "alice")
+	stub.must(t, bob, "init_owner", "o1", "bob", COMPANY)
+	stub.must(t, alice, "init_owner", "o2", "alice", COMPANY)
+	alice_op, _ := stub.CreateCompositeKey("op~txid", []string{"tx" + strconv.Itoa(stub.txs)})
+
+	stub.must(t, admin, "purge_owner_pii", "o1")
+	if contains(stub.scans, "op~txid") {
+		t.Fatal("purge should not scan the whole operation log")
+	}
+	if _, written := stub.writes[alice_op]; written {
+		t.Fatal("purge rewrote an operation of another owner")
+	}
+}
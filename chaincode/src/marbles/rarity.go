@@ -0,0 +1,263 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Rarity Definitions - every tier has a global mint cap, 0 means no cap
+//
+// Mint counts are kept per tier (composite key "rarity_count") and marbles are indexed by
+// tier (composite key "rarity~id") so tier queries don't have to scan every marble.
+// ============================================================================================================================
+const RARITY_CAPS_KEY = "_rarity_caps"
+
+var rarity_tiers = []string{"common", "rare", "legendary"}
+
+// used until an admin changes them with set_rarity_cap()
+var default_rarity_caps = map[string]int{
+	"common":    0,
+	"rare":      100,
+	"legendary": 10,
+}
+
+// ============================================================================================================================
+// Mint Rarity - count a new marble against its tier cap and index it, errors if the cap is reached
+// ============================================================================================================================
+func mint_rarity(stub shim.ChaincodeStubInterface, rarity string, marble_id string) error {
+	if !contains(rarity_tiers, rarity) {
+		return errors.New("Rarity must be one of common, rare or legendary")
+	}
+
+	caps, err := get_rarity_caps_config(stub)
+	if err != nil {
+		return err
+	}
+	count, err := get_rarity_count(stub, rarity)
+	if err != nil {
+		return err
+	}
+	if caps[rarity] > 0 && count >= caps[rarity] {
+		return errors.New("Mint cap reached for " + rarity + " marbles - " + strconv.Itoa(caps[rarity]))
+	}
+
+	countKey, err := stub.CreateCompositeKey("rarity_count", []string{rarity})
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(countKey, []byte(strconv.Itoa(count + 1)))
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := stub.CreateCompositeKey("rarity~id", []string{rarity, marble_id})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte{0x00})               //the key is the index, value just can't be nil
+}
+
+// ============================================================================================================================
+// Unindex Rarity - remove a marble from the rarity index
+// ============================================================================================================================
+func unindex_rarity(stub shim.ChaincodeStubInterface, marble Marble) error {
+	if len(marble.Rarity) == 0 {                               //marbles from before rarity existed
+		return nil
+	}
+	indexKey, err := stub.CreateCompositeKey("rarity~id", []string{marble.Rarity, marble.Id})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+// ============================================================================================================================
+// Set Rarity Cap - set the mint cap of a tier. Admin only
+//
+// Inputs - Array of Strings
+//       0    ,   1
+//     tier   ,  cap
+//  "legendary", "5"
+// ============================================================================================================================
+func set_rarity_cap(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_rarity_cap")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rarity := args[0]
+	if !contains(rarity_tiers, rarity) {
+		return shim.Error("Rarity must be one of common, rare or legendary")
+	}
+	mint_cap, err := strconv.Atoi(args[1])
+	if err != nil || mint_cap < 0 {
+		return shim.Error("2nd argument must be a non-negative numeric string")
+	}
+
+	caps, err := get_rarity_caps_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	caps[rarity] = mint_cap
+	capsAsBytes, _ := json.Marshal(caps)                         //convert to array of bytes
+	err = stub.PutState(RARITY_CAPS_KEY, capsAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_rarity_cap")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Rarity Caps - read the cap and mint count of every tier
+//
+// Inputs - none
+//
+// Returns:
+// {
+//	"legendary": {"cap": 10, "minted": 3},
+//	...
+// }
+// ============================================================================================================================
+func get_rarity_caps(stub shim.ChaincodeStubInterface) pb.Response {
+	type TierStats struct {
+		Cap    int `json:"cap"`
+		Minted int `json:"minted"`
+	}
+	stats := map[string]TierStats{}
+
+	caps, err := get_rarity_caps_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, rarity := range rarity_tiers {
+		count, err := get_rarity_count(stub, rarity)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stats[rarity] = TierStats{Cap: caps[rarity], Minted: count}
+	}
+
+	statsAsBytes, _ := json.Marshal(stats)                       //convert to array of bytes
+	return shim.Success(statsAsBytes)
+}
+
+// ============================================================================================================================
+// Get Marbles By Rarity - read every marble of a tier via the rarity index
+//
+// Up to the result cap, if it's cut short pass the bookmark back to get the rest.
+//
+// Inputs - Array of Strings
+//       0     ,   1 (optional)
+//     tier    ,    bookmark
+//  "legendary", "m999999999"
+// ============================================================================================================================
+func get_marbles_by_rarity(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var marbles []Marble
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("rarity~id", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(keyParts[1]) {
+			continue
+		}
+		if results.full(keyParts[1]) {
+			break
+		}
+		marble, err := get_marble(stub, keyParts[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		marbles = append(marbles, marble)
+	}
+
+	return results.response(marbles)
+}
+
+// ============================================================================================================================
+// Rarity helpers
+// ============================================================================================================================
+func get_rarity_caps_config(stub shim.ChaincodeStubInterface) (map[string]int, error) {
+	caps := map[string]int{}
+	for tier, mint_cap := range default_rarity_caps {               //copy, so callers can't change the defaults
+		caps[tier] = mint_cap
+	}
+	capsAsBytes, err := stub.GetState(RARITY_CAPS_KEY)
+	if err != nil {
+		return caps, errors.New("Failed to get rarity caps")
+	}
+	if capsAsBytes == nil {
+		return caps, nil
+	}
+	err = json.Unmarshal(capsAsBytes, &caps)                     //stored caps override the defaults
+	if err != nil {
+		return caps, errors.New("Failed to parse rarity caps")
+	}
+	return caps, nil
+}
+
+func get_rarity_count(stub shim.ChaincodeStubInterface, rarity string) (int, error) {
+	countKey, err := stub.CreateCompositeKey("rarity_count", []string{rarity})
+	if err != nil {
+		return 0, err
+	}
+	countAsBytes, err := stub.GetState(countKey)
+	if err != nil {
+		return 0, errors.New("Failed to get rarity count")
+	}
+	if countAsBytes == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(countAsBytes))
+}
@@ -23,11 +23,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
+const MAX_CONSISTENT_READS = 100
+const MAX_PAGE_SIZE = 100
+
 // ============================================================================================================================
 // Read - read a generic variable from ledger
 //
@@ -45,10 +49,6 @@ func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting read")
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting key of the var to query")
-	}
-
 	// input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
@@ -66,10 +66,60 @@ func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	return shim.Success(valAsbytes)                  //send it onward
 }
 
+// ============================================================================================================================
+// Read Consistent - read several keys in one go, use this when you need a marble and its owner (etc.) to agree
+//
+// Every read in one invoke comes from the same ledger snapshot, separate read() calls can land either side of a block.
+// Returns an object of key -> value, JSON values as is, other values as strings, missing keys as null.
+//
+// Inputs - Array of strings
+//       0     ,        1        , ...
+//      key    ,       key       , ...
+// "m999999999", "o9999999999999"
+// ============================================================================================================================
+func read_consistent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting read_consistent")
+
+	if len(args) > MAX_CONSISTENT_READS {
+		return shim.Error("Too many keys. Expecting at most 100")
+	}
+
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	values := map[string]interface{}{}
+	for _, key := range args {
+		valAsbytes, err := stub.GetState(key)          //get the var from ledger
+		if err != nil {
+			return shim.Error("Failed to get state for " + key)
+		}
+		var parsed interface{}
+		if valAsbytes == nil {
+			values[key] = nil
+		} else if json.Unmarshal(valAsbytes, &parsed) == nil {
+			values[key] = json.RawMessage(valAsbytes)
+		} else {
+			values[key] = string(valAsbytes)
+		}
+	}
+
+	fmt.Println("- end read_consistent")
+	valuesAsBytes, _ := json.Marshal(values)         //convert to array of bytes
+	return shim.Success(valuesAsBytes)
+}
+
 // ============================================================================================================================
 // Get everything we need (owners + marbles + companies)
 //
-// Inputs - none
+// Marbles then owners, up to the result cap. If it's cut short "truncated" is true, pass "bookmark" back to get the rest.
+//
+// Inputs - Array of strings
+//        0 (optional)
+//        bookmark
+//       "o1490898165086"
 //
 // Returns:
 // {
@@ -90,13 +140,24 @@ func read(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 //	}]
 // }
 // ============================================================================================================================
-func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
+func read_everything(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	type Everything struct {
-		Owners   []Owner   `json:"owners"`
-		Marbles  []Marble  `json:"marbles"`
+		Owners    []Owner   `json:"owners"`
+		Marbles   []Marble  `json:"marbles"`
+		Truncated bool      `json:"truncated,omitempty"`
+		Bookmark  string    `json:"bookmark,omitempty"`
 	}
 	var everything Everything
 
+	bookmark := ""
+	if len(args) > 0 {
+		bookmark = args[0]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// ---- Get All Marbles ---- //
 	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
 	if err != nil {
@@ -105,14 +166,20 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 	defer resultsIterator.Close()
 	
 	for resultsIterator.HasNext() {
-		queryKeyAsStr, queryValAsBytes, err := resultsIterator.Next()
+		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		if results.skip(queryResponse.Key) {
+			continue
+		}
+		if results.full(queryResponse.Key) {
+			break
+		}
 
-		fmt.Println("on marble id - ", queryKeyAsStr)
+		fmt.Println("on marble id - ", queryResponse.Key)
 		var marble Marble
-		json.Unmarshal(queryValAsBytes, &marble)                  //un stringify it aka JSON.parse()
+		json.Unmarshal(queryResponse.Value, &marble)              //un stringify it aka JSON.parse()
 		everything.Marbles = append(everything.Marbles, marble)   //add this marble to the list
 	}
 	fmt.Println("marble array - ", everything.Marbles)
@@ -124,18 +191,26 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 	}
 	defer ownersIterator.Close()
 
-	for ownersIterator.HasNext() {
-		queryKeyAsStr, queryValAsBytes, err := ownersIterator.Next()
+	for ownersIterator.HasNext() && !results.truncated {
+		queryResponse, err := ownersIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		if results.skip(queryResponse.Key) {
+			continue
+		}
+		if results.full(queryResponse.Key) {
+			break
+		}
 		
-		fmt.Println("on owner id - ", queryKeyAsStr)
+		fmt.Println("on owner id - ", queryResponse.Key)
 		var owner Owner
-		json.Unmarshal(queryValAsBytes, &owner)                  //un stringify it aka JSON.parse()
+		json.Unmarshal(queryResponse.Value, &owner)              //un stringify it aka JSON.parse()
 		everything.Owners = append(everything.Owners, owner)     //add this marble to the list
 	}
 	fmt.Println("owner array - ", everything.Owners)
+	everything.Truncated = results.truncated
+	everything.Bookmark = results.next
 
 	//change to array of bytes
 	everythingAsBytes, _ := json.Marshal(everything)             //convert to array of bytes
@@ -147,6 +222,8 @@ func read_everything(stub shim.ChaincodeStubInterface) pb.Response {
 //
 // Shows Off GetHistoryForKey() - reading complete history of a key/value
 //
+// Up to the result cap, if it's cut short the bookmark can be passed to get_history_paginated() for the rest.
+//
 // Inputs - Array of strings
 //  0
 //  id
@@ -160,13 +237,14 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var history []AuditHistory;
 	var marble Marble
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-
 	marbleId := args[0]
 	fmt.Printf("- start getHistoryForMarble: %s\n", marbleId)
 
+	results, err := new_result_cap(stub, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Get History
 	resultsIterator, err := stub.GetHistoryForKey(marbleId)
 	if err != nil {
@@ -174,29 +252,104 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	}
 	defer resultsIterator.Close()
 
+	lastTxId := ""
 	for resultsIterator.HasNext() {
-		txID, historicValue, err := resultsIterator.Next()
+		modification, err := resultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		if results.full(lastTxId) {                //cut short, the bookmark is the last tx id we did return
+			break
+		}
+		lastTxId = modification.TxId
 
 		var tx AuditHistory
-		tx.TxId = txID                             //copy transaction id over
-		json.Unmarshal(historicValue, &marble)     //un stringify it aka JSON.parse()
-		if historicValue == nil {                  //marble has been deleted
+		tx.TxId = modification.TxId                //copy transaction id over
+		json.Unmarshal(modification.Value, &marble) //un stringify it aka JSON.parse()
+		if modification.IsDelete {                 //marble has been deleted
 			var emptyMarble Marble
 			tx.Value = emptyMarble                 //copy nil marble
 		} else {
-			json.Unmarshal(historicValue, &marble) //un stringify it aka JSON.parse()
+			json.Unmarshal(modification.Value, &marble) //un stringify it aka JSON.parse()
 			tx.Value = marble                      //copy marble over
 		}
 		history = append(history, tx)              //add this tx to the list
 	}
 	fmt.Printf("- getHistoryForMarble returning:\n%s", history)
 
+	return results.response(history)
+}
+
+// ============================================================================================================================
+// Get history of asset, a page at a time
+//
+// The bookmark is the tx id of the last entry of the previous page, history only gets added to so it stays valid.
+// An empty bookmark in the response means there are no more pages.
+//
+// Inputs - Array of strings
+//          0          ,      1     ,       2 (optional)
+//          id         ,  page size ,      bookmark
+//  "m01490985296352SjAyM",  "20"   ,   "2b2d7c4c..."
+// ============================================================================================================================
+func get_history_paginated(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type HistoryEntry struct {
+		TxId     string `json:"txId"`
+		Value    Marble `json:"value"`
+		IsDelete bool   `json:"isDelete"`
+	}
+	type HistoryPage struct {
+		History  []HistoryEntry `json:"history"`
+		Bookmark string         `json:"bookmark"`
+	}
+	var page HistoryPage
+
+	marbleId := args[0]
+	pageSize, err := strconv.Atoi(args[1])
+	if err != nil || pageSize <= 0 || pageSize > MAX_PAGE_SIZE {
+		return shim.Error("2nd argument must be a numeric string from 1 to " + strconv.Itoa(MAX_PAGE_SIZE))
+	}
+	bookmark := ""
+	if len(args) == 3 {
+		bookmark = args[2]
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(marbleId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	page.History = []HistoryEntry{}
+	skipping := len(bookmark) > 0
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if skipping {                              //skip up to and including the bookmark
+			skipping = modification.TxId != bookmark
+			continue
+		}
+		if len(page.History) == pageSize {         //there's more, hand back where this page ended
+			page.Bookmark = page.History[pageSize - 1].TxId
+			break
+		}
+
+		var entry HistoryEntry
+		entry.TxId = modification.TxId             //copy transaction id over
+		entry.IsDelete = modification.IsDelete     //marble has been deleted
+		if !entry.IsDelete {
+			json.Unmarshal(modification.Value, &entry.Value) //un stringify it aka JSON.parse()
+		}
+		page.History = append(page.History, entry)
+	}
+	if skipping {
+		return shim.Error("Bookmark is not in the history of " + marbleId)
+	}
+
 	//change to array of bytes
-	historyAsBytes, _ := json.Marshal(history)     //convert to array of bytes
-	return shim.Success(historyAsBytes)
+	pageAsBytes, _ := json.Marshal(page)           //convert to array of bytes
+	return shim.Success(pageAsBytes)
 }
 
 // ============================================================================================================================
@@ -204,19 +357,22 @@ func getHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 //
 // Shows Off GetStateByRange() - reading a multiple key/values from the ledger
 //
+// Up to the result cap, if it's cut short use the bookmark as the start key to get the rest.
+//
 // Inputs - Array of strings
 //       0     ,    1
 //   startKey  ,  endKey
 //  "marbles1" , "marbles5"
 // ============================================================================================================================
 func getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
 	startKey := args[0]
 	endKey := args[1]
 
+	results, err := new_result_cap(stub, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	resultsIterator, err := stub.GetStateByRange(startKey, endKey)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -229,22 +385,25 @@ func getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Respo
 
 	bArrayMemberAlreadyWritten := false
 	for resultsIterator.HasNext() {
-		queryResultKey, queryResultValue, err := resultsIterator.Next()
+		queryResponse, err := resultsIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		if results.full(queryResponse.Key) {      //cut short, the bookmark is the start key for the next call
+			break
+		}
 		// Add a comma before array members, suppress it for the first array member
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
 		}
 		buffer.WriteString("{\"Key\":")
 		buffer.WriteString("\"")
-		buffer.WriteString(queryResultKey)
+		buffer.WriteString(queryResponse.Key)
 		buffer.WriteString("\"")
 
 		buffer.WriteString(", \"Record\":")
 		// Record is a JSON object, so we write as-is
-		buffer.WriteString(string(queryResultValue))
+		buffer.WriteString(string(queryResponse.Value))
 		buffer.WriteString("}")
 		bArrayMemberAlreadyWritten = true
 	}
@@ -252,5 +411,185 @@ func getMarblesByRange(stub shim.ChaincodeStubInterface, args []string) pb.Respo
 
 	fmt.Printf("- getMarblesByRange queryResult:\n%s\n", buffer.String())
 
+	if results.truncated {
+		list := json.RawMessage(buffer.Bytes())
+		return results.response(&list)
+	}
 	return shim.Success(buffer.Bytes())
 }
+
+// ============================================================================================================================
+// Query Marbles By Owner - read every marble an owner holds with a CouchDB rich query
+//
+// Shows Off GetQueryResult() - a selector on docType and owner id. Peers on LevelDB will return an error instead,
+// the index it uses is in META-INF/statedb/couchdb/indexes. Up to the result cap, like search_text() the bookmark
+// is how many results to skip.
+//
+// Inputs - Array of strings
+//          0      ,  1 (optional)
+//       owner id  ,    bookmark
+//  "o9999999999999",    "1000"
+// ============================================================================================================================
+func query_marbles_by_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+
+	owner_id := args[0]
+	skip := 0
+	if len(args) == 2 {
+		skip, err = strconv.Atoi(args[1])
+		if err != nil || skip < 0 {
+			return shim.Error("2nd argument must be a non-negative numeric string")
+		}
+	}
+	results, err := new_result_cap(stub, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// build the selector with json.Marshal so the owner id can't break out of it
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":  "marble",
+			"owner.id": owner_id,
+		},
+		"use_index": []string{"_design/indexOwnerDoc", "indexOwner"},
+		"skip":      skip,
+		"limit":     results.max + 1,                             //one extra so we know if there's more
+	}
+	queryAsBytes, _ := json.Marshal(query)                       //convert to array of bytes
+	fmt.Println("- query_marbles_by_owner query: " + string(queryAsBytes))
+
+	resultsIterator, err := stub.GetQueryResult(string(queryAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	marbles := []Marble{}                                        //an empty array, not null, for owners with none
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.full(strconv.Itoa(skip + len(marbles))) {
+			break
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		marbles = append(marbles, marble)
+	}
+
+	return results.response(marbles)
+}
+
+// ============================================================================================================================
+// List Marbles - read every marble a page at a time
+//
+// Shows Off GetStateByRangeWithPagination() - the peer hands back the bookmark for the next page, an empty one means
+// that was the last page. Paginated queries are only allowed in read only functions.
+//
+// Inputs - Array of strings
+//       0    ,   1 (optional)
+//  page size ,    bookmark
+//     "20"   , "m1490898165086"
+// ============================================================================================================================
+func list_marbles(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type MarblePage struct {
+		Marbles  []Marble `json:"marbles"`
+		Bookmark string   `json:"bookmark"`
+	}
+	var page MarblePage
+
+	pageSize, err := strconv.Atoi(args[0])
+	if err != nil || pageSize <= 0 || pageSize > MAX_PAGE_SIZE {
+		return shim.Error("1st argument must be a numeric string from 1 to " + strconv.Itoa(MAX_PAGE_SIZE))
+	}
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+
+	resultsIterator, metadata, err := stub.GetStateByRangeWithPagination("m0", "m9999999999999999999", int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	page.Marbles = []Marble{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		page.Marbles = append(page.Marbles, marble)
+	}
+	if len(page.Marbles) == pageSize {                           //a short page is the last one
+		page.Bookmark = metadata.Bookmark
+	}
+
+	//change to array of bytes
+	pageAsBytes, _ := json.Marshal(page)                         //convert to array of bytes
+	return shim.Success(pageAsBytes)
+}
+
+// ============================================================================================================================
+// Get Marble History - the marble's provenance, every version with its tx id, timestamp and whether it was a delete
+//
+// Shows Off GetHistoryForKey() with the modern shim - each entry is a KeyModification. Owners and colors are in the values.
+// Up to the result cap, if it's cut short the bookmark can be passed to get_history_paginated() for the rest.
+//
+// Inputs - Array of strings
+//          0
+//          id
+//  "m01490985296352SjAyM"
+// ============================================================================================================================
+func get_marble_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type ProvenanceEntry struct {
+		TxId      string  `json:"txId"`
+		Timestamp int64   `json:"timestamp"` //ms, tx time
+		Value     *Marble `json:"value"`     //null for a delete
+		IsDelete  bool    `json:"isDelete"`
+	}
+	history := []ProvenanceEntry{}
+
+	marble_id := args[0]
+	results, err := new_result_cap(stub, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetHistoryForKey(marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	lastTxId := ""
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.full(lastTxId) {                              //cut short, the bookmark is the last tx id we did return
+			break
+		}
+		lastTxId = modification.TxId
+
+		var entry ProvenanceEntry
+		entry.TxId = modification.TxId
+		entry.IsDelete = modification.IsDelete
+		if modification.Timestamp != nil {
+			entry.Timestamp = modification.Timestamp.Seconds * 1000 + int64(modification.Timestamp.Nanos) / 1000000
+		}
+		if !entry.IsDelete {
+			var marble Marble
+			json.Unmarshal(modification.Value, &marble)          //un stringify it aka JSON.parse()
+			entry.Value = &marble
+		}
+		history = append(history, entry)
+	}
+
+	return results.response(history)
+}
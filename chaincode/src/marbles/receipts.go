@@ -0,0 +1,129 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Transfer Receipt Definitions - one per transfer, under composite key "receipt" [marble id, padded tx time, tx id]
+//
+// The org that submitted the transfer comes from the creator's msp id. The orgs that endorsed it can't be stored,
+// endorsements are collected after chaincode runs. Look up the receipt's tx id in its block to see them.
+// ============================================================================================================================
+type TransferReceipt struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	MarbleId    string `json:"marbleId"`
+	FromOwnerId string `json:"fromOwnerId"`
+	ToOwnerId   string `json:"toOwnerId"`
+	Invoker     string `json:"invoker"`    //invoker id
+	InvokerMsp  string `json:"invokerMsp"` //org of the submitter
+	Timestamp   int64  `json:"timestamp"`  //ms, tx time
+	TxId        string `json:"txId"`
+}
+
+// ============================================================================================================================
+// Get Transfer Receipts - every transfer receipt of a marble, oldest first
+//
+// Inputs - Array of Strings
+//       0      ,    1 (optional)
+//  marble id   ,      bookmark
+// "m999999999" , "001490898165086:2b2d7c4c..."
+// ============================================================================================================================
+func get_transfer_receipts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var receipts []TransferReceipt
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("receipt", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		position := keyParts[1] + ":" + keyParts[2]              //tx time then tx id, sorts the same as the keys
+		if results.skip(position) {
+			continue
+		}
+		if results.full(position) {
+			break
+		}
+		var receipt TransferReceipt
+		json.Unmarshal(queryResponse.Value, &receipt)            //un stringify it aka JSON.parse()
+		receipts = append(receipts, receipt)
+	}
+
+	return results.response(receipts)
+}
+
+// ============================================================================================================================
+// Transfer Receipt helpers
+// ============================================================================================================================
+func put_transfer_receipt(stub shim.ChaincodeStubInterface, marble_id string, from string, to string) error {
+	var receipt TransferReceipt
+	var err error
+	receipt.ObjectType = "receipt"
+	receipt.MarbleId = marble_id
+	receipt.FromOwnerId = from
+	receipt.ToOwnerId = to
+	receipt.TxId = stub.GetTxID()
+	receipt.Invoker, err = get_invoker(stub)
+	if err != nil {
+		return err
+	}
+	receipt.InvokerMsp, err = get_invoker_msp(stub)
+	if err != nil {
+		return err
+	}
+	receipt.Timestamp, err = get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+
+	padded_time := fmt.Sprintf("%015d", receipt.Timestamp)        //pad it so keys sort by time
+	key, err := stub.CreateCompositeKey(receipt.ObjectType, []string{marble_id, padded_time, receipt.TxId})
+	if err != nil {
+		return err
+	}
+	receiptAsBytes, _ := json.Marshal(receipt)                   //convert to array of bytes
+	return stub.PutState(key, receiptAsBytes)
+}
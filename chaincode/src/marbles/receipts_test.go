@@ -0,0 +1,49 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransferReceiptsAreCapped(t *testing.T) {
+	stub, admin, alice, mallory := new_identity_fixture(t)
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	stub.now += 1000
+	stub.must(t, mallory, "set_owner", "m1", "o1", COMPANY)
+	stub.now += 1000
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	stub.must(t, admin, "set_max_results", "2")
+
+	var page ResultPage
+	response := stub.must(t, alice, "get_transfer_receipts", "m1")
+	json.Unmarshal(response.Payload, &page)
+	if !page.Truncated || len(page.Results.([]interface{})) != 2 {
+		t.Fatalf("expected the first 2 receipts - %s", response.Payload)
+	}
+	var receipts []TransferReceipt
+	response = stub.must(t, alice, "get_transfer_receipts", "m1", page.Bookmark)
+	json.Unmarshal(response.Payload, &receipts)
+	if len(receipts) != 1 || receipts[0].ToOwnerId != "o2" || receipts[0].FromOwnerId != "o1" {
+		t.Fatalf("the bookmark should pick up at the 3rd receipt - %s", response.Payload)
+	}
+}
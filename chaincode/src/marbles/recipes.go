@@ -0,0 +1,247 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Recipes ----- //
+type Recipe struct {
+	ObjectType string       `json:"docType"` //field for couchdb
+	Id         string       `json:"id"`
+	Inputs     []RecipeItem `json:"inputs"`
+	Output     RecipeItem   `json:"output"` //count is ignored, crafting makes one marble
+}
+
+type RecipeItem struct {
+	Color string `json:"color"`
+	Size  int    `json:"size"`
+	Count int    `json:"count"`
+}
+
+// ============================================================================================================================
+// Set Recipe - create or replace a crafting recipe. Admin only
+//
+// Inputs - Array of Strings
+//      0     ,     1
+//  recipe id , recipe json
+//  "big_red" , "{"inputs":[{"color":"red","size":2,"count":2}],"output":{"color":"red","size":5}}"
+// ============================================================================================================================
+func set_recipe(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_recipe")
+
+	// input sanitation, only the id, the recipe is json
+	err = sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var recipe Recipe
+	err = json.Unmarshal([]byte(args[1]), &recipe)
+	if err != nil {
+		return shim.Error("Recipe must be valid json")
+	}
+	if len(recipe.Inputs) == 0 {
+		return shim.Error("Recipe must have at least one input")
+	}
+	for _, input := range recipe.Inputs {
+		if len(input.Color) == 0 || input.Count < 1 {
+			return shim.Error("Every recipe input needs a color and a count")
+		}
+	}
+	if len(recipe.Output.Color) == 0 {
+		return shim.Error("Recipe output needs a color")
+	}
+
+	recipe.ObjectType = "recipe"
+	recipe.Id = args[0]
+	key, err := stub.CreateCompositeKey(recipe.ObjectType, []string{recipe.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recipeAsBytes, _ := json.Marshal(recipe)                     //convert to array of bytes
+	err = stub.PutState(key, recipeAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_recipe")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Recipe - read a crafting recipe
+//
+// Inputs - Array of Strings
+//      0
+//  recipe id
+//  "big_red"
+// ============================================================================================================================
+func get_recipe(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	recipe, err := get_recipe_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recipeAsBytes, _ := json.Marshal(recipe)                     //convert to array of bytes
+	return shim.Success(recipeAsBytes)
+}
+
+// ============================================================================================================================
+// Craft - burn the input marbles of a recipe and mint its output
+//
+// All inputs must belong to the same owner, the crafted marble goes to that owner and remembers its inputs.
+//
+// Inputs - Array of Strings
+//      0    ,       1      ,        2        ,    3...
+//  recipe id, new marble id, authing company , input marble ids
+//  "big_red", "m999999999" , "united marbles", "m111111111", "m222222222"
+// ============================================================================================================================
+func craft(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting craft")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	recipe_id := args[0]
+	new_marble_id := args[1]
+	authed_by_company := args[2]
+	input_ids := args[3:]
+
+	recipe, err := get_recipe_doc(stub, recipe_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// get the inputs, they must all be distinct and owned by one owner
+	var inputs []Marble
+	for i, input_id := range input_ids {
+		if contains(input_ids[:i], input_id) {
+			return shim.Error("Input marble listed twice - " + input_id)
+		}
+		marble, err := get_marble(stub, input_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(inputs) > 0 && marble.Owner.Id != inputs[0].Owner.Id {
+			return shim.Error("All input marbles must have the same owner")
+		}
+		if len(marble.Shares) > 0 {
+			return shim.Error("Co-owned marbles cannot be crafted - " + input_id)
+		}
+		if marble.Protected {
+			return shim.Error("Protected marbles cannot be crafted - " + input_id)
+		}
+		inputs = append(inputs, marble)
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if inputs[0].Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize crafting for '" + inputs[0].Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can burn its marbles
+	err = check_owner_identity(stub, inputs[0].Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = match_recipe(recipe, inputs)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// burn the inputs
+	for _, marble := range inputs {
+		err = remove_marble(stub, marble)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// mint the output
+	var crafted Marble
+	crafted.Id = new_marble_id
+	crafted.Color = normalize_name(recipe.Output.Color)
+	crafted.Size = recipe.Output.Size
+	crafted.Owner = inputs[0].Owner
+	crafted.CraftedFrom = input_ids
+	err = create_marble(stub, &crafted)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end craft")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Recipe helpers
+// ============================================================================================================================
+func get_recipe_doc(stub shim.ChaincodeStubInterface, recipe_id string) (Recipe, error) {
+	var recipe Recipe
+	key, err := stub.CreateCompositeKey("recipe", []string{recipe_id})
+	if err != nil {
+		return recipe, err
+	}
+	recipeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return recipe, errors.New("Failed to get recipe")
+	}
+	json.Unmarshal(recipeAsBytes, &recipe)                       //un stringify it aka JSON.parse()
+	if recipe.Id != recipe_id {                                  //test if recipe is actually here or just nil
+		return recipe, errors.New("Recipe does not exist - " + recipe_id)
+	}
+	return recipe, nil
+}
+
+// the inputs must be exactly what the recipe asks for, no more no less
+func match_recipe(recipe Recipe, inputs []Marble) error {
+	needed := map[string]int{}
+	for _, item := range recipe.Inputs {
+		needed[normalize_name(item.Color) + "/" + strconv.Itoa(item.Size)] += item.Count
+	}
+	for _, marble := range inputs {
+		needed[marble.Color + "/" + strconv.Itoa(marble.Size)]--
+	}
+	for kind, count := range needed {
+		if count != 0 {
+			return errors.New("Input marbles do not match recipe '" + recipe.Id + "', off by " + strconv.Itoa(count) + " for " + kind)
+		}
+	}
+	return nil
+}
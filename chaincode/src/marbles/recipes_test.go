@@ -0,0 +1,41 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCraftKeepsHoldingsCount(t *testing.T) {
+	stub, admin, alice, _ := new_identity_fixture(t)
+	stub.must(t, alice, "init_marble", "m2", "blue", "35", "o1", COMPANY)
+	stub.must(t, alice, "init_marble", "m3", "blue", "35", "o1", COMPANY)
+	stub.must(t, admin, "set_recipe", "big_red", `{"inputs":[{"color":"blue","size":35,"count":2}],"output":{"color":"red","size":35}}`)
+
+	// two burns and a mint in one tx, each one has to see the last
+	stub.must(t, alice, "craft", "big_red", "m9", COMPANY, "m1", "m2")
+	if stub.holdings("o1") != "2" {
+		t.Fatalf("holdings should be 2 after crafting 2 of 3 marbles into 1, got %s", stub.holdings("o1"))
+	}
+	if stub.marble(t, "m9").Owner.Id != "o1" {
+		t.Fatal("crafted marble should belong to o1")
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Reconciliation Definitions - compare an authoritative ownership snapshot from outside the ledger to the ledger
+//
+// Corrections skip the transfer rules (velocity, inspection, badges), the snapshot is the authority.
+// Every confirmed run is kept under composite key "reconciliation" [tx id], the op log has the before values.
+// ============================================================================================================================
+type SnapshotEntry struct {
+	MarbleId string `json:"marbleId"`
+	OwnerId  string `json:"ownerId"`
+}
+
+type ReconcileDiff struct {
+	MarbleId      string `json:"marbleId"`
+	Problem       string `json:"problem"` //owner_mismatch, missing_on_ledger, missing_in_snapshot, duplicate_in_snapshot, unknown_owner or co_owned
+	LedgerOwnerId string `json:"ledgerOwnerId,omitempty"`
+	SnapshotOwner string `json:"snapshotOwnerId,omitempty"`
+	Corrected     bool   `json:"corrected"`
+}
+
+type Reconciliation struct {
+	ObjectType string          `json:"docType"` //field for couchdb
+	TxId       string          `json:"txId"`
+	Applied    bool            `json:"applied"`
+	RunBy      string          `json:"runBy"` //invoker id
+	RunAt      int64           `json:"runAt"` //ms, tx time
+	Diffs      []ReconcileDiff `json:"diffs"`
+}
+
+// ============================================================================================================================
+// Reconcile Ownership - diff a snapshot against the ledger, and with confirm "true" give mismatched marbles their
+// snapshot owner. Admin only
+//
+// Only owner mismatches can be corrected, the rest are reported. Co-owned marbles are reported and left alone.
+//
+// Inputs - Array of Strings
+//                           0                             ,    1
+//                    snapshot json                        , confirm
+// "[{"marbleId":"m999999999","ownerId":"o9999999999999"}]",  "true"
+// ============================================================================================================================
+func reconcile_ownership(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var snapshot []SnapshotEntry
+	var run Reconciliation
+	var err error
+	fmt.Println("starting reconcile_ownership")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = json.Unmarshal([]byte(args[0]), &snapshot)             //un stringify it aka JSON.parse()
+	if err != nil {
+		return shim.Error("Snapshot must be a json array of {marbleId, ownerId}")
+	}
+	confirm, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be 'true' or 'false'")
+	}
+
+	// ---- Get All Marbles ---- //
+	ledger := map[string]Marble{}
+	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		if marble.ObjectType == "marble" {
+			ledger[marble.Id] = marble
+		}
+	}
+
+	// ---- Compare ---- //
+	run.Diffs = []ReconcileDiff{}
+	in_snapshot := map[string]bool{}
+	holdings := map[string]int{}                                 //net change per owner, applied once at the end
+	for _, entry := range snapshot {
+		if in_snapshot[entry.MarbleId] {
+			run.Diffs = append(run.Diffs, ReconcileDiff{MarbleId: entry.MarbleId, Problem: "duplicate_in_snapshot", SnapshotOwner: entry.OwnerId})
+			continue
+		}
+		in_snapshot[entry.MarbleId] = true
+		marble, found := ledger[entry.MarbleId]
+		if !found {
+			run.Diffs = append(run.Diffs, ReconcileDiff{MarbleId: entry.MarbleId, Problem: "missing_on_ledger", SnapshotOwner: entry.OwnerId})
+			continue
+		}
+		if marble.Owner.Id == entry.OwnerId {
+			continue
+		}
+
+		diff := ReconcileDiff{MarbleId: marble.Id, Problem: "owner_mismatch", LedgerOwnerId: marble.Owner.Id, SnapshotOwner: entry.OwnerId}
+		owner, err := get_owner(stub, entry.OwnerId)
+		if err != nil {
+			diff.Problem = "unknown_owner"
+		} else if len(marble.Shares) > 0 {
+			diff.Problem = "co_owned"
+		} else if confirm {
+			holdings[marble.Owner.Id]--
+			holdings[owner.Id]++
+			err = record_activity(stub, "reconcile", marble.Id, marble.Owner.Id, owner.Id)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			old_owner_id := marble.Owner.Id
+			marble.Owner.Id = owner.Id                           //change the owner
+			marble.Owner.Username = owner.Username
+			marble.Owner.Company = owner.Company
+			err = put_marble_as(stub, marble, "transferred")
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			err = emit_marble_event(stub, "owner_changed", marble, old_owner_id, owner.Id)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			diff.Corrected = true
+		}
+		run.Diffs = append(run.Diffs, diff)
+	}
+
+	ids := []string{}
+	for id := range ledger {
+		if !in_snapshot[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)                                            //same order on every endorser
+	for _, id := range ids {
+		run.Diffs = append(run.Diffs, ReconcileDiff{MarbleId: id, Problem: "missing_in_snapshot", LedgerOwnerId: ledger[id].Owner.Id})
+	}
+
+	// ---- Store The Audit Record ---- //
+	run.ObjectType = "reconciliation"
+	run.TxId = stub.GetTxID()
+	run.Applied = confirm
+	run.RunBy, err = get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	run.RunAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	runAsBytes, _ := json.Marshal(run)                           //convert to array of bytes
+
+	if confirm {
+		owner_ids := []string{}
+		for owner_id := range holdings {
+			owner_ids = append(owner_ids, owner_id)
+		}
+		sort.Strings(owner_ids)
+		for _, owner_id := range owner_ids {
+			err = track_holdings(stub, owner_id, holdings[owner_id])
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+
+		key, err := stub.CreateCompositeKey(run.ObjectType, []string{run.TxId})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutState(key, runAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end reconcile_ownership")
+	return shim.Success(runAsBytes)
+}
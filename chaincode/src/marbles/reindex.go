@@ -0,0 +1,200 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Index Rebuild Definitions - the indexes that can be worked out from the marbles and owners alone
+//
+// rarity_count and serial_count are left alone, they count mints not supply, and deleted marbles are gone.
+// ============================================================================================================================
+var rebuildable_indexes = []string{"rarity~id", "tag", "holdings", "username", "serial", FINGERPRINT_INDEX}
+
+type RebuildSummary struct {
+	Marbles      int `json:"marbles"`
+	Rarities     int `json:"rarityEntries"`
+	Tags         int `json:"tagEntries"`
+	Holdings     int `json:"holdingsEntries"`
+	Usernames    int `json:"usernameEntries"`
+	Serials      int `json:"serialEntries"`
+	Fingerprints int `json:"fingerprintEntries"`
+	Removed      int `json:"removedEntries"` //index entries that no marble backs up anymore
+}
+
+// ============================================================================================================================
+// Rebuild Indexes From State - ignore the existing index entries and rebuild them by scanning every marble and owner. Admin only
+//
+// Use after a migration, or if an index got out of sync with the marbles. Owners with clashing usernames
+// (made before usernames were indexed) keep the first owner id in the index, same for clashing fingerprints.
+//
+// Inputs - none
+// ============================================================================================================================
+func rebuild_indexes_from_state(stub shim.ChaincodeStubInterface) pb.Response {
+	var summary RebuildSummary
+	fmt.Println("starting rebuild_indexes_from_state")
+
+	err := check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// work out what the indexes should hold
+	wanted := map[string][]byte{}
+	holdings := map[string]int{}
+	resultsIterator, err := stub.GetStateByRange("m0", "m9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		if marble.ObjectType != "marble" {
+			continue
+		}
+		summary.Marbles++
+
+		if len(marble.Rarity) > 0 {
+			indexKey, err := stub.CreateCompositeKey("rarity~id", []string{marble.Rarity, marble.Id})
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			wanted[indexKey] = []byte{0x00}                      //the key is the index, value just can't be nil
+			summary.Rarities++
+		}
+		for _, tag := range marble.Tags {
+			indexKey, err := stub.CreateCompositeKey("tag", []string{tag, marble.Id})
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			wanted[indexKey] = []byte{0x00}
+			summary.Tags++
+		}
+		if marble.Serial > 0 {
+			indexKey, err := serial_key(stub, marble.Color, marble.Serial)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			wanted[indexKey] = []byte(marble.Id)
+			summary.Serials++
+		}
+		if len(marble.Fingerprint) > 0 {
+			indexKey, err := stub.CreateCompositeKey(FINGERPRINT_INDEX, []string{marble.Fingerprint})
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if _, taken := wanted[indexKey]; !taken {
+				wanted[indexKey] = []byte(marble.Id)
+				summary.Fingerprints++
+			}
+		}
+		holdings[marble.Owner.Id]++
+	}
+	ownersIterator, err := stub.GetStateByRange("o0", "o9999999999999999999")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer ownersIterator.Close()
+
+	for ownersIterator.HasNext() {
+		queryResponse, err := ownersIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		var owner Owner
+		json.Unmarshal(queryResponse.Value, &owner)              //un stringify it aka JSON.parse()
+		if owner.ObjectType != "marble_owner" || owner.Username == REDACTED || len(owner.Username) == 0 {
+			continue
+		}
+		key, err := stub.CreateCompositeKey("username", []string{owner.Company, normalize_name(owner.Username)})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if _, taken := wanted[key]; !taken {
+			wanted[key] = []byte(owner.Id)
+			summary.Usernames++
+		}
+	}
+
+	for owner_id, count := range holdings {
+		key, err := stub.CreateCompositeKey("holdings", []string{owner_id})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		wanted[key] = []byte(strconv.Itoa(count))
+		summary.Holdings++
+	}
+
+	// drop whatever is there that shouldn't be, changed values get rewritten below
+	for _, index := range rebuildable_indexes {
+		indexIterator, err := stub.GetStateByPartialCompositeKey(index, []string{})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for indexIterator.HasNext() {
+			queryResponse, err := indexIterator.Next()
+			if err != nil {
+				indexIterator.Close()
+				return shim.Error(err.Error())
+			}
+			if _, ok := wanted[queryResponse.Key]; !ok {
+				err = stub.DelState(queryResponse.Key)
+				if err != nil {
+					indexIterator.Close()
+					return shim.Error(err.Error())
+				}
+				summary.Removed++
+			}
+		}
+		indexIterator.Close()
+	}
+
+	// and write the rest, in key order so every endorser logs the same operation
+	keys := []string{}
+	for key := range wanted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err = stub.PutState(key, wanted[key])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	summaryAsBytes, _ := json.Marshal(summary)                   //convert to array of bytes
+	fmt.Println("- end rebuild_indexes_from_state")
+	return shim.Success(summaryAsBytes)
+}
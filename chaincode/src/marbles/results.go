@@ -0,0 +1,157 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Result Cap Definitions - the most results a list/query function will return in one response
+//
+// A response over the cap is cut short and comes back as a ResultPage, the bookmark says where to pick up.
+// Responses under the cap look the same as they always have.
+// ============================================================================================================================
+const MAX_RESULTS_KEY = "_max_results"
+const DEFAULT_MAX_RESULTS = 1000
+const MAX_RESULTS_LIMIT = 10000
+
+type ResultPage struct {
+	Results   interface{} `json:"results"`
+	Truncated bool        `json:"truncated"`
+	Bookmark  string      `json:"bookmark"`
+}
+
+// ============================================================================================================================
+// Set Max Results - set the most results a list/query function returns in one response. Admin only
+//
+// Inputs - Array of Strings
+//     0
+//    max
+//  "500"
+// ============================================================================================================================
+func set_max_results(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_max_results")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	max, err := strconv.Atoi(args[0])
+	if err != nil || max <= 0 || max > MAX_RESULTS_LIMIT {
+		return shim.Error("1st argument must be a numeric string from 1 to " + strconv.Itoa(MAX_RESULTS_LIMIT))
+	}
+
+	err = stub.PutState(MAX_RESULTS_KEY, []byte(strconv.Itoa(max)))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_max_results")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Max Results - read the result cap
+//
+// Inputs - none
+// ============================================================================================================================
+func get_max_results(stub shim.ChaincodeStubInterface) pb.Response {
+	max, err := get_max_results_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(strconv.Itoa(max)))
+}
+
+// ============================================================================================================================
+// Result Cap helpers
+//
+// Use it like so, ids must come in sorted order for the bookmark to work -
+//	if results.skip(id) { continue }
+//	if results.full(id) { break }
+//	...append...
+// ============================================================================================================================
+type result_cap struct {
+	max       int
+	bookmark  string //skip ids before this one
+	count     int
+	truncated bool
+	next      string //where the next page starts
+}
+
+func get_max_results_config(stub shim.ChaincodeStubInterface) (int, error) {
+	maxAsBytes, err := stub.GetState(MAX_RESULTS_KEY)
+	if err != nil {
+		return 0, errors.New("Failed to get max results")
+	}
+	if maxAsBytes == nil {
+		return DEFAULT_MAX_RESULTS, nil
+	}
+	max, err := strconv.Atoi(string(maxAsBytes))
+	if err != nil {
+		return 0, errors.New("Failed to parse max results")
+	}
+	return max, nil
+}
+
+func new_result_cap(stub shim.ChaincodeStubInterface, bookmark string) (*result_cap, error) {
+	max, err := get_max_results_config(stub)
+	if err != nil {
+		return nil, err
+	}
+	return &result_cap{max: max, bookmark: bookmark}, nil
+}
+
+// true if this id comes before the bookmark
+func (results *result_cap) skip(id string) bool {
+	return id < results.bookmark
+}
+
+// true if the cap is reached, next is remembered as the bookmark. otherwise counts one more result
+func (results *result_cap) full(next string) bool {
+	if results.count < results.max {
+		results.count++
+		return false
+	}
+	results.truncated = true
+	results.next = next
+	return true
+}
+
+// the list as is, or wrapped in a ResultPage if it was cut short
+func (results *result_cap) response(list interface{}) pb.Response {
+	if !results.truncated {
+		listAsBytes, _ := json.Marshal(list)                     //convert to array of bytes
+		return shim.Success(listAsBytes)
+	}
+	page := ResultPage{Results: list, Truncated: true, Bookmark: results.next}
+	pageAsBytes, _ := json.Marshal(page)                         //convert to array of bytes
+	return shim.Success(pageAsBytes)
+}
@@ -0,0 +1,253 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Scheduled Transfers ----- //
+type ScheduledTransfer struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	Id          string `json:"id"`      //tx id of the schedule_transfer call
+	MarbleId    string `json:"marbleId"`
+	FromOwnerId string `json:"fromOwnerId"` //owner when scheduled
+	ToOwnerId   string `json:"toOwnerId"`
+	NotBefore   int64  `json:"notBefore"`  //ms since epoch, compared against the tx timestamp
+	MarbleTxId  string `json:"marbleTxId"` //marble's LastModifiedTxId when scheduled, any later write makes the schedule stale
+}
+
+// ============================================================================================================================
+// Schedule Transfer - record a transfer that anyone can execute once the unlock time has passed
+//
+// The schedule is bound to the marble as it is now. If the marble is written again (moved away and back included)
+// the schedule is stale and the owner has to schedule it again.
+//
+// Inputs - Array of Strings
+//       0     ,        1      ,       2        ,         3
+//  marble id  ,  to owner id  ,  not before ms ,  company that auth the transfer
+// "m999999999", "o99999999999", "1490898165086", "united marbles"
+//
+// Returns - the scheduled transfer id
+// ============================================================================================================================
+func schedule_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting schedule_transfer")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	new_owner_id := args[1]
+	authed_by_company := args[3]
+	not_before, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return shim.Error("3rd argument must be a numeric string")
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, err = get_owner(stub, new_owner_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + new_owner_id)
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can schedule it away
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var transfer ScheduledTransfer
+	transfer.ObjectType = "scheduled_transfer"
+	transfer.Id = stub.GetTxID()
+	transfer.MarbleId = marble.Id
+	transfer.FromOwnerId = marble.Owner.Id
+	transfer.ToOwnerId = new_owner_id
+	transfer.NotBefore = not_before
+	transfer.MarbleTxId = marble.LastModifiedTxId
+
+	key, err := stub.CreateCompositeKey(transfer.ObjectType, []string{transfer.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transferAsBytes, _ := json.Marshal(transfer)                 //convert to array of bytes
+	err = stub.PutState(key, transferAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end schedule_transfer")
+	return shim.Success([]byte(transfer.Id))
+}
+
+// ============================================================================================================================
+// Execute Scheduled Transfer - move the marble if the unlock time is past, anyone can call this
+//
+// Inputs - Array of Strings
+//        0
+//  transfer id
+//  "2b2d7c4c..."
+// ============================================================================================================================
+func execute_scheduled_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting execute_scheduled_transfer")
+
+	// the tx id is a 64 char hash, so no length limit here
+	if len(args[0]) == 0 {
+		return shim.Error("Argument 0 must be a non-empty string")
+	}
+
+	key, err := stub.CreateCompositeKey("scheduled_transfer", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer, err := get_scheduled_transfer(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now < transfer.NotBefore {
+		return shim.Error("Transfer is locked until " + strconv.FormatInt(transfer.NotBefore, 10) + ", it is " + strconv.FormatInt(now, 10))
+	}
+
+	marble, err := get_marble(stub, transfer.MarbleId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Id != transfer.FromOwnerId || marble.LastModifiedTxId != transfer.MarbleTxId {
+		return shim.Error("Marble has changed since this transfer was scheduled - " + marble.Id)
+	}
+
+	owner, err := get_owner(stub, transfer.ToOwnerId)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + transfer.ToOwnerId)
+	}
+
+	err = transfer_marble(stub, &marble, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// its done, remove it so it cannot run twice
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete scheduled transfer")
+	}
+
+	fmt.Println("- end execute_scheduled_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Cancel Scheduled Transfer - the owner that scheduled a transfer drops it
+//
+// Inputs - Array of Strings
+//        0      ,         1
+//  transfer id  ,  company that auth the transfer
+//  "2b2d7c4c...", "united marbles"
+// ============================================================================================================================
+func cancel_scheduled_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting cancel_scheduled_transfer")
+
+	// the tx id is a 64 char hash, so no length limit on it
+	if len(args[0]) == 0 {
+		return shim.Error("Argument 0 must be a non-empty string")
+	}
+	err = sanitize_arguments(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transfer_id := args[0]
+	authed_by_company := args[1]
+
+	key, err := stub.CreateCompositeKey("scheduled_transfer", []string{transfer_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer, err := get_scheduled_transfer(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := get_owner(stub, transfer.FromOwnerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can cancel it
+	err = check_owner_identity(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to delete scheduled transfer")
+	}
+
+	fmt.Println("- end cancel_scheduled_transfer")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Scheduled Transfer - get a scheduled transfer from ledger by its composite key
+// ============================================================================================================================
+func get_scheduled_transfer(stub shim.ChaincodeStubInterface, key string) (ScheduledTransfer, error) {
+	var transfer ScheduledTransfer
+	transferAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return transfer, errors.New("Failed to get scheduled transfer")
+	}
+	json.Unmarshal(transferAsBytes, &transfer)                   //un stringify it aka JSON.parse()
+
+	if len(transfer.Id) == 0 {                                   //test if transfer is actually here or just nil
+		return transfer, errors.New("Scheduled transfer does not exist")
+	}
+	return transfer, nil
+}
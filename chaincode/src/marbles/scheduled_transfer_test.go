@@ -0,0 +1,46 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+func TestScheduleGoesStaleAfterARoundTrip(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	transfer_id := string(stub.must(t, alice, "schedule_transfer", "m1", "o2", "0", COMPANY).Payload)
+
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	stub.must(t, mallory, "set_owner", "m1", "o1", COMPANY)
+	stub.must_fail(t, mallory, "execute_scheduled_transfer", transfer_id)
+	if stub.marble(t, "m1").Owner.Id != "o1" {
+		t.Fatal("a stale schedule moved the marble")
+	}
+}
+
+func TestCancelScheduledTransfer(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	transfer_id := string(stub.must(t, alice, "schedule_transfer", "m1", "o2", "0", COMPANY).Payload)
+
+	stub.must_fail(t, mallory, "cancel_scheduled_transfer", transfer_id, COMPANY)
+	stub.must(t, alice, "cancel_scheduled_transfer", transfer_id, COMPANY)
+	stub.must_fail(t, mallory, "execute_scheduled_transfer", transfer_id)
+}
@@ -0,0 +1,155 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Text Search Definitions - free text lives in a marble's description and notes
+//
+// search_text() is a CouchDB rich query, peers on LevelDB will return an error instead.
+// The index it uses is in META-INF/statedb/couchdb/indexes and gets installed with the chaincode package.
+// ============================================================================================================================
+const MAX_TEXT_LENGTH = 512
+
+// ============================================================================================================================
+// Set Description - set a marble's description and notes
+//
+// Inputs - Array of Strings
+//       0     ,         1        ,        2        ,         3
+//  marble id  ,    description   ,      notes      ,  authing company
+// "m999999999", "swirly cat's eye", "chip on one side", "united marbles"
+// ============================================================================================================================
+func set_description(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_description")
+
+	// input sanitation, the text can be longer than the usual limit and notes can be empty
+	err = sanitize_arguments([]string{args[0], args[3]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args[1]) == 0 || len(args[1]) > MAX_TEXT_LENGTH {
+		return shim.Error("Description must be a non-empty string <= 512 characters")
+	}
+	if len(args[2]) > MAX_TEXT_LENGTH {
+		return shim.Error("Notes must be a string <= 512 characters")
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[3]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize changes for '" + marble.Owner.Company + "'.")
+	}
+
+	marble.Description = args[1]
+	marble.Notes = args[2]
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_description")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Search Text - find marbles whose description or notes contain some text, case insensitive
+//
+// Up to the result cap. CouchDB doesn't hand results back in key order, so here the bookmark is how many results
+// to skip. Marbles written between calls can shift the pages.
+//
+// Inputs - Array of Strings
+//       0     ,  1 (optional)
+//     text    ,    bookmark
+//  "cat's eye",     "1000"
+// ============================================================================================================================
+func search_text(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var marbles []Marble
+	var err error
+
+	if len(args[0]) == 0 || len(args[0]) > MAX_TEXT_LENGTH {
+		return shim.Error("Search text must be a non-empty string <= 512 characters")
+	}
+	skip := 0
+	if len(args) == 2 {
+		skip, err = strconv.Atoi(args[1])
+		if err != nil || skip < 0 {
+			return shim.Error("2nd argument must be a non-negative numeric string")
+		}
+	}
+	results, err := new_result_cap(stub, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// build the selector with json.Marshal so the search text can't break out of it
+	pattern := "(?i)" + regexp.QuoteMeta(args[0])
+	query := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": "marble",
+			"$or": []interface{}{
+				map[string]interface{}{"description": map[string]string{"$regex": pattern}},
+				map[string]interface{}{"notes": map[string]string{"$regex": pattern}},
+			},
+		},
+		"use_index": []string{"_design/indexTextDoc", "indexText"},
+		"skip": skip,
+		"limit": results.max + 1,                                //one extra so we know if there's more
+	}
+	queryAsBytes, _ := json.Marshal(query)                       //convert to array of bytes
+
+	resultsIterator, err := stub.GetQueryResult(string(queryAsBytes))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.full(strconv.Itoa(skip + len(marbles))) {
+			break
+		}
+		var marble Marble
+		json.Unmarshal(queryResponse.Value, &marble)             //un stringify it aka JSON.parse()
+		marbles = append(marbles, marble)
+	}
+
+	return results.response(marbles)
+}
@@ -0,0 +1,123 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Serial Definitions - every new marble gets the next serial number for its color, blue #1, blue #2, ...
+//
+// The count per color only goes up, a deleted marble's serial is never handed out again.
+// The index is composite key "serial" + color + zero padded serial, its value is the marble id.
+// ============================================================================================================================
+const SERIAL_DIGITS = 10
+
+// ============================================================================================================================
+// Get Marble By Serial - read the marble with a color's serial number
+//
+// Inputs - Array of Strings
+//      0   ,   1
+//    color , serial
+//   "blue" ,  "42"
+// ============================================================================================================================
+func get_marble_by_serial(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	color := normalize_name(args[0])
+	serial, err := strconv.Atoi(args[1])
+	if err != nil || serial <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+
+	indexKey, err := serial_key(stub, color, serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	idAsBytes, err := stub.GetState(indexKey)
+	if err != nil {
+		return shim.Error("Failed to get serial index")
+	}
+	if idAsBytes == nil {
+		return shim.Error("No marble has serial " + serial_label(color, serial))
+	}
+
+	marbleAsBytes, err := stub.GetState(string(idAsBytes))
+	if err != nil {
+		return shim.Error("Failed to get marble")
+	}
+	return shim.Success(marbleAsBytes)
+}
+
+// ============================================================================================================================
+// Serial helpers
+// ============================================================================================================================
+
+// give a new marble the next serial for its color
+func assign_serial(stub shim.ChaincodeStubInterface, marble *Marble) error {
+	countKey, err := stub.CreateCompositeKey("serial_count", []string{marble.Color})
+	if err != nil {
+		return err
+	}
+	countAsBytes, err := stub.GetState(countKey)
+	if err != nil {
+		return errors.New("Failed to get serial count")
+	}
+	count := 0
+	if countAsBytes != nil {
+		count, _ = strconv.Atoi(string(countAsBytes))
+	}
+
+	marble.Serial = count + 1
+	err = stub.PutState(countKey, []byte(strconv.Itoa(marble.Serial)))
+	if err != nil {
+		return err
+	}
+	indexKey, err := serial_key(stub, marble.Color, marble.Serial)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(indexKey, []byte(marble.Id))
+}
+
+func unindex_serial(stub shim.ChaincodeStubInterface, marble Marble) error {
+	if marble.Serial == 0 {                                      //marbles from before serials existed
+		return nil
+	}
+	indexKey, err := serial_key(stub, marble.Color, marble.Serial)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(indexKey)
+}
+
+func serial_key(stub shim.ChaincodeStubInterface, color string, serial int) (string, error) {
+	return stub.CreateCompositeKey("serial", []string{color, fmt.Sprintf("%0" + strconv.Itoa(SERIAL_DIGITS) + "d", serial)})
+}
+
+// "blue #0042"
+func serial_label(color string, serial int) string {
+	return fmt.Sprintf("%s #%04d", color, serial)
+}
@@ -0,0 +1,216 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Register Public Key - store an owner's ECDSA public key so they can authorize actions off chain
+//
+// Inputs - Array of Strings
+//           0     ,          1            ,         2
+//      owner id   ,  public key (PEM)     ,  authing company
+// "o9999999999999", "-----BEGIN PUBLIC...", "united marbles"
+// ============================================================================================================================
+func register_public_key(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting register_public_key")
+
+	// input sanitation, a PEM key is longer than the usual limit so only check ids
+	err = sanitize_arguments([]string{args[0], args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner_id := args[0]
+	publicKey := args[1]
+	authed_by_company := args[2]
+
+	// make sure its a key we can actually use
+	_, err = parse_public_key(publicKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize keys for '" + owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can register its key
+	err = check_owner_identity(stub, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner.PublicKey = publicKey
+	err = put_owner(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end register_public_key")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Set Owner Signed - transfer a marble using an authorization the current owner signed off chain
+//
+// Anyone can submit this (a relayer/custodian), the signature is what authorizes it.
+// The signed payload is the string "set_owner:<channel id>:<marble id>:<marble's lastModifiedTxId>:<current owner id>:<new owner id>"
+// signed with ECDSA over its sha256, the signature is base64 of the ASN.1 DER encoding. The channel keeps it from being
+// used on another channel, the tx id from being used again once the marble changes, like when it comes back to the signer.
+// With a nonce the payload gets ":<nonce>" on the end, and it can only be used once (see nonce.go).
+//
+// Inputs - Array of Strings
+//       0     ,        1      ,       2     ,  3 (optional)
+//  marble id  ,  to owner id  ,   signature ,    nonce
+// "m999999999", "o99999999999", "MEUCIQD...",     "7"
+// ============================================================================================================================
+func set_owner_signed(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_owner_signed")
+
+	// input sanitation, signatures are longer than the usual limit so only check ids
+	err = sanitize_arguments(args[:2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	new_owner_id := args[1]
+	signature := args[2]
+	nonce := ""
+	if len(args) == 4 {
+		nonce = args[3]
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	new_owner, err := get_owner(stub, new_owner_id)
+	if err != nil {
+		return shim.Error("This owner does not exist - " + new_owner_id)
+	}
+
+	// the current owner must have signed this exact transfer
+	current_owner, err := get_owner(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	payload := signed_transfer_payload(stub, marble, new_owner.Id)
+	if len(nonce) > 0 {
+		payload += ":" + nonce
+	}
+	err = verify_signature(current_owner, payload, signature)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = use_nonce(stub, current_owner.Id, nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = transfer_marble(stub, &marble, new_owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_owner_signed")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Signed Transfer Payload - what the current owner signs to hand a marble to new_owner_id, without the nonce
+// ============================================================================================================================
+func signed_transfer_payload(stub shim.ChaincodeStubInterface, marble Marble, new_owner_id string) string {
+	return "set_owner:" + stub.GetChannelID() + ":" + marble.Id + ":" + marble.LastModifiedTxId + ":" + marble.Owner.Id + ":" + new_owner_id
+}
+
+// ============================================================================================================================
+// Verify Signature - check an owner signed the payload with their registered key
+// ============================================================================================================================
+func verify_signature(owner Owner, payload string, signature string) error {
+	if len(owner.PublicKey) == 0 {
+		return errors.New("Owner has not registered a public key - " + owner.Id)
+	}
+	publicKey, err := parse_public_key(owner.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	sigAsBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("Signature must be base64")
+	}
+	var sig struct {
+		R, S *big.Int
+	}
+	_, err = asn1.Unmarshal(sigAsBytes, &sig)
+	if err != nil {
+		return errors.New("Signature must be an ASN.1 DER encoded ECDSA signature")
+	}
+
+	digest := sha256.Sum256([]byte(payload))
+	if !ecdsa.Verify(publicKey, digest[:], sig.R, sig.S) {
+		return errors.New("Signature does not match payload for owner - " + owner.Id)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Parse Public Key - PEM string to an ECDSA public key
+// ============================================================================================================================
+func parse_public_key(publicKey string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("Public key must be PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Failed to parse public key")
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key must be an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
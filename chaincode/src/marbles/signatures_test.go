@@ -0,0 +1,67 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload string) string {
+	digest := sha256.Sum256([]byte(payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigAsBytes, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sigAsBytes)
+}
+
+func TestSignedTransferCannotBeReplayed(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAsBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	stub.must(t, alice, "register_public_key", "o1", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyAsBytes})), COMPANY)
+
+	marble := stub.marble(t, "m1")
+	signature := sign(t, key, "set_owner:" + stub.GetChannelID() + ":m1:" + marble.LastModifiedTxId + ":o1:o2")
+	stub.must(t, mallory, "set_owner_signed", "m1", "o2", signature)
+	stub.must(t, mallory, "set_owner", "m1", "o1", COMPANY)
+
+	stub.must_fail(t, mallory, "set_owner_signed", "m1", "o2", signature)            //m1 is back with o1, but it has moved since
+	if stub.marble(t, "m1").Owner.Id != "o1" {
+		t.Fatal("the old signature should not move the marble again")
+	}
+}
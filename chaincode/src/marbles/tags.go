@@ -0,0 +1,194 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Tag Marble - add tags to a marble, tags are lower cased and duplicates are ignored
+//
+// Shows off composite keys as an index - each tag is stored as key "tag" + tag + marble id, so finding
+// every marble with a tag is a range scan instead of reading every marble.
+//
+// Inputs - Array of Strings
+//       0     ,         1        ,   2...
+//  marble id  ,  authing company ,  tags
+// "m999999999", "united marbles" , "vintage", "swirl"
+// ============================================================================================================================
+func tag_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting tag_marble")
+	return update_tags(stub, args, true)
+}
+
+// ============================================================================================================================
+// Untag Marble - remove tags from a marble
+//
+// Inputs - Array of Strings
+//       0     ,         1        ,   2...
+//  marble id  ,  authing company ,  tags
+// "m999999999", "united marbles" , "vintage"
+// ============================================================================================================================
+func untag_marble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting untag_marble")
+	return update_tags(stub, args, false)
+}
+
+func update_tags(stub shim.ChaincodeStubInterface, args []string, add bool) pb.Response {
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[1]
+	var tags []string
+	for _, tag := range args[2:] {
+		tag = normalize_name(tag)
+		if len(tag) == 0 {
+			return shim.Error("Tags must have something other than spaces")
+		}
+		tags = append(tags, tag)
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize tags for '" + marble.Owner.Company + "'.")
+	}
+
+	// update the marble's list
+	var changed []string
+	if add {
+		for _, tag := range tags {
+			if !contains(marble.Tags, tag) {
+				marble.Tags = append(marble.Tags, tag)
+				changed = append(changed, tag)
+			}
+		}
+	} else {
+		var kept []string
+		for _, tag := range marble.Tags {
+			if contains(tags, tag) {
+				changed = append(changed, tag)
+			} else {
+				kept = append(kept, tag)
+			}
+		}
+		marble.Tags = kept
+	}
+
+	// and the index
+	err = index_tags(stub, marble_id, changed, add)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_marble(stub, marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end update tags")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Marbles By Tag - read every marble with a tag via the tag index
+//
+// Up to the result cap, if it's cut short pass the bookmark back to get the rest.
+//
+// Inputs - Array of Strings
+//      0    ,   1 (optional)
+//     tag   ,    bookmark
+//  "vintage", "m999999999"
+// ============================================================================================================================
+func get_marbles_by_tag(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var marbles []Marble
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("tag", []string{normalize_name(args[0])})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(keyParts[1]) {
+			continue
+		}
+		if results.full(keyParts[1]) {
+			break
+		}
+		marble, err := get_marble(stub, keyParts[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		marbles = append(marbles, marble)
+	}
+
+	return results.response(marbles)
+}
+
+// ============================================================================================================================
+// Index Tags - add or remove a marble's tag index entries
+// ============================================================================================================================
+func index_tags(stub shim.ChaincodeStubInterface, marble_id string, tags []string, add bool) error {
+	for _, tag := range tags {
+		indexKey, err := stub.CreateCompositeKey("tag", []string{tag, marble_id})
+		if err != nil {
+			return err
+		}
+		if add {
+			err = stub.PutState(indexKey, []byte{0x00})          //the key is the index, value just can't be nil
+		} else {
+			err = stub.DelState(indexKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ----- Templates ----- //
+type Template struct {
+	ObjectType string            `json:"docType"` //field for couchdb
+	Id         string            `json:"id"`
+	Name       string            `json:"name"`
+	Color      string            `json:"color"`
+	Size       int               `json:"size"`
+	Rarity     string            `json:"rarity,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ============================================================================================================================
+// Set Template - create or replace a marble template. Admin only
+//
+// Inputs - Array of Strings
+//       0     ,       1
+//  template id, template json
+//   "classic" , "{"name":"Classic Blue","color":"blue","size":35,"attributes":{"finish":"glossy"}}"
+// ============================================================================================================================
+func set_template(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_template")
+
+	// input sanitation, only the id, the template is json
+	err = sanitize_arguments(args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var template Template
+	err = json.Unmarshal([]byte(args[1]), &template)
+	if err != nil {
+		return shim.Error("Template must be valid json")
+	}
+	if len(template.Name) == 0 || len(template.Color) == 0 {
+		return shim.Error("Template needs a name and a color")
+	}
+	if len(template.Rarity) > 0 && !contains(rarity_tiers, template.Rarity) {
+		return shim.Error("Rarity must be one of common, rare or legendary")
+	}
+
+	template.ObjectType = "marble_template"
+	template.Id = args[0]
+	template.Color = normalize_name(template.Color)
+	key, err := stub.CreateCompositeKey(template.ObjectType, []string{template.Id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	templateAsBytes, _ := json.Marshal(template)                 //convert to array of bytes
+	err = stub.PutState(key, templateAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_template")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Template - read a marble template
+//
+// Inputs - Array of Strings
+//       0
+//  template id
+//   "classic"
+// ============================================================================================================================
+func get_template(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	template, err := get_template_doc(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	templateAsBytes, _ := json.Marshal(template)                 //convert to array of bytes
+	return shim.Success(templateAsBytes)
+}
+
+// ============================================================================================================================
+// Init Marble From Template - create a new marble with a template's color, size, rarity and attributes
+//
+// Inputs - Array of Strings
+//       0     ,      1      ,        2        ,        3
+//  template id,  marble id  ,     owner id    ,  authing company
+//   "classic" , "m999999999", "o9999999999999", "united marbles"
+// ============================================================================================================================
+func init_marble_from_template(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting init_marble_from_template")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	template_id := args[0]
+	marble_id := args[1]
+	owner_id := args[2]
+	authed_by_company := args[3]
+
+	template, err := get_template_doc(stub, template_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	owner, err := get_owner(stub, owner_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot authorize creation for '" + owner.Company + "'.")
+	}
+
+	var marble Marble
+	marble.Id = marble_id
+	marble.Color = template.Color
+	marble.Size = template.Size
+	marble.Rarity = template.Rarity
+	marble.TemplateId = template.Id
+	marble.Attributes = template.Attributes
+	marble.Owner.Id = owner.Id
+	marble.Owner.Username = owner.Username
+	marble.Owner.Company = owner.Company
+	err = create_marble(stub, &marble)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end init_marble_from_template")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Template Doc - get a marble template from ledger
+// ============================================================================================================================
+func get_template_doc(stub shim.ChaincodeStubInterface, template_id string) (Template, error) {
+	var template Template
+	key, err := stub.CreateCompositeKey("marble_template", []string{template_id})
+	if err != nil {
+		return template, err
+	}
+	templateAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return template, errors.New("Failed to get template")
+	}
+	json.Unmarshal(templateAsBytes, &template)                   //un stringify it aka JSON.parse()
+	if template.Id != template_id {                              //test if template is actually here or just nil
+		return template, errors.New("Template does not exist - " + template_id)
+	}
+	return template, nil
+}
@@ -0,0 +1,278 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Velocity Definitions - too many transfers in a window flags the marble and/or the sending owner
+// ============================================================================================================================
+const VELOCITY_RULES_KEY = "_velocity_rules"
+
+type VelocityRules struct {
+	WindowMs           int64 `json:"windowMs"`
+	MaxMarbleTransfers int   `json:"maxMarbleTransfers"` //transfers of one marble per window, 0 is no limit
+	MaxOwnerTransfers  int   `json:"maxOwnerTransfers"`  //transfers sent by one owner per window, 0 is no limit
+}
+
+// ============================================================================================================================
+// Check Velocity - called on every transfer
+//
+// Flagged marbles/owners cannot trade. Otherwise the transfer is counted, and if it trips a rule the
+// marble/owner is flagged. The tripping transfer still goes through, an error here would roll back the flag too.
+// ============================================================================================================================
+func check_velocity(stub shim.ChaincodeStubInterface, marble *Marble, new_owner Owner) error {
+	if marble.Flagged {
+		return errors.New("Marble is flagged for review and cannot be traded - " + marble.Id)
+	}
+	if new_owner.Flagged {
+		return errors.New("Owner is flagged for review and cannot trade - " + new_owner.Id)
+	}
+	from_owner, err := get_owner(stub, marble.Owner.Id)
+	if err != nil {
+		return err
+	}
+	if from_owner.Flagged {
+		return errors.New("Owner is flagged for review and cannot trade - " + from_owner.Id)
+	}
+
+	rules, err := get_velocity_rules_config(stub)
+	if err != nil {
+		return err
+	}
+	if rules.WindowMs <= 0 {                                     //no rules configured
+		return nil
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return err
+	}
+
+	count, err := count_transfer(stub, "marble", marble.Id, now, rules.WindowMs)
+	if err != nil {
+		return err
+	}
+	if rules.MaxMarbleTransfers > 0 && count > rules.MaxMarbleTransfers {
+		fmt.Println("- flagging marble " + marble.Id)
+		marble.Flagged = true                                    //caller stores the marble
+		marble.FlaggedAt = now
+		err = put_flag_event(stub, "marble", marble.Id, "flagged")
+		if err != nil {
+			return err
+		}
+	}
+
+	count, err = count_transfer(stub, "owner", from_owner.Id, now, rules.WindowMs)
+	if err != nil {
+		return err
+	}
+	if rules.MaxOwnerTransfers > 0 && count > rules.MaxOwnerTransfers {
+		fmt.Println("- flagging owner " + from_owner.Id)
+		from_owner.Flagged = true
+		from_owner.FlaggedAt = now
+		err = put_owner(stub, from_owner)
+		if err != nil {
+			return err
+		}
+		err = put_flag_event(stub, "owner", from_owner.Id, "flagged")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record a transfer time for a marble/owner, returns how many are inside the window
+func count_transfer(stub shim.ChaincodeStubInterface, kind string, id string, now int64, window int64) (int, error) {
+	key, err := stub.CreateCompositeKey("velocity", []string{kind, id})
+	if err != nil {
+		return 0, err
+	}
+	var times []int64
+	timesAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return 0, errors.New("Failed to get transfer velocity")
+	}
+	json.Unmarshal(timesAsBytes, &times)                         //un stringify it aka JSON.parse()
+
+	var recent []int64
+	for _, t := range times {                                    //drop anything older than the window
+		if now - t < window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+
+	recentAsBytes, _ := json.Marshal(recent)                     //convert to array of bytes
+	err = stub.PutState(key, recentAsBytes)
+	if err != nil {
+		return 0, err
+	}
+	return len(recent), nil
+}
+
+// ============================================================================================================================
+// Set Velocity Rules - configure the transfer limits. Admin only
+//
+// Inputs - Array of Strings
+//       0    ,         1           ,         2
+//   window ms, max marble transfers, max owner transfers
+//  "3600000" ,        "3"          ,       "20"
+// ============================================================================================================================
+func set_velocity_rules(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting set_velocity_rules")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var rules VelocityRules
+	rules.WindowMs, err = strconv.ParseInt(args[0], 10, 64)
+	if err != nil || rules.WindowMs < 0 {
+		return shim.Error("1st argument must be a non-negative numeric string")
+	}
+	rules.MaxMarbleTransfers, err = strconv.Atoi(args[1])
+	if err != nil || rules.MaxMarbleTransfers < 0 {
+		return shim.Error("2nd argument must be a non-negative numeric string")
+	}
+	rules.MaxOwnerTransfers, err = strconv.Atoi(args[2])
+	if err != nil || rules.MaxOwnerTransfers < 0 {
+		return shim.Error("3rd argument must be a non-negative numeric string")
+	}
+
+	rulesAsBytes, _ := json.Marshal(rules)                       //convert to array of bytes
+	err = stub.PutState(VELOCITY_RULES_KEY, rulesAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end set_velocity_rules")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Velocity Rules - read the transfer limits
+//
+// Inputs - none
+// ============================================================================================================================
+func get_velocity_rules(stub shim.ChaincodeStubInterface) pb.Response {
+	rules, err := get_velocity_rules_config(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rulesAsBytes, _ := json.Marshal(rules)                       //convert to array of bytes
+	return shim.Success(rulesAsBytes)
+}
+
+func get_velocity_rules_config(stub shim.ChaincodeStubInterface) (VelocityRules, error) {
+	var rules VelocityRules
+	rulesAsBytes, err := stub.GetState(VELOCITY_RULES_KEY)
+	if err != nil {
+		return rules, errors.New("Failed to get velocity rules")
+	}
+	if rulesAsBytes == nil {                                     //no limits until an admin sets them
+		return rules, nil
+	}
+	err = json.Unmarshal(rulesAsBytes, &rules)                   //un stringify it aka JSON.parse()
+	if err != nil {
+		return rules, errors.New("Failed to parse velocity rules")
+	}
+	return rules, nil
+}
+
+// ============================================================================================================================
+// Clear Flag - let a flagged marble or owner trade again. Compliance role only
+//
+// Inputs - Array of Strings
+//      0    ,      1
+//    type   ,     id
+//  "marble" , "m999999999"
+// ============================================================================================================================
+func clear_flag(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting clear_flag")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = check_role(stub, "compliance")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	kind := args[0]
+	id := args[1]
+	if kind == "marble" {
+		marble, err := get_marble(stub, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		marble.Flagged = false
+		marble.FlaggedAt = 0
+		err = put_marble(stub, marble)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else if kind == "owner" {
+		owner, err := get_owner(stub, id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		owner.Flagged = false
+		owner.FlaggedAt = 0
+		err = put_owner(stub, owner)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		return shim.Error("Type must be 'marble' or 'owner'")
+	}
+	err = put_flag_event(stub, kind, id, "cleared")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// start their count over
+	key, err := stub.CreateCompositeKey("velocity", []string{kind, id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return shim.Error("Failed to reset transfer velocity")
+	}
+
+	fmt.Println("- end clear_flag")
+	return shim.Success(nil)
+}
@@ -0,0 +1,348 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Warranty Definitions - warranties and claims live under composite keys next to the marble
+// ============================================================================================================================
+type Warranty struct {
+	ObjectType string `json:"docType"` //field for couchdb
+	MarbleId   string `json:"marbleId"`
+	Issuer     string `json:"issuer"`    //company that owes the after sale obligation
+	IssuedAt   int64  `json:"issuedAt"`  //ms, tx time
+	ExpiresAt  int64  `json:"expiresAt"` //ms, tx time + term
+}
+
+type WarrantyClaim struct {
+	ObjectType  string `json:"docType"` //field for couchdb
+	Id          string `json:"id"`      //tx id of the file_warranty_claim call
+	MarbleId    string `json:"marbleId"`
+	OwnerId     string `json:"ownerId"` //owner when the claim was filed
+	Issuer      string `json:"issuer"`  //company that issued the warranty claimed against, it resolves the claim
+	Description string `json:"description"`
+	Status      string `json:"status"` //"open", "approved" or "rejected"
+	FiledAt     int64  `json:"filedAt"`
+	ResolvedAt  int64  `json:"resolvedAt,omitempty"`
+}
+
+// ============================================================================================================================
+// Issue Warranty - attach a warranty to a marble, usually done at mint or sale time by the selling company
+//
+// An unexpired warranty can't be replaced, its issuer keeps the obligation until it runs out.
+//
+// Inputs - Array of Strings
+//       0     ,      1     ,         2
+//  marble id  ,  term ms   ,  authing company (the issuer)
+// "m999999999", "31536000000", "united marbles"
+// ============================================================================================================================
+func issue_warranty(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting issue_warranty")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	authed_by_company := args[2]
+	term, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || term <= 0 {
+		return shim.Error("2nd argument must be a positive numeric string")
+	}
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// check authorizing company (see note in set_owner() about how this is quirky)
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot issue warranties for '" + marble.Owner.Company + "'.")
+	}
+
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := get_warranty_doc(stub, marble_id)
+	if err == nil && now <= existing.ExpiresAt {
+		return shim.Error("Marble already has a warranty from '" + existing.Issuer + "' until " + strconv.FormatInt(existing.ExpiresAt, 10))
+	}
+
+	var warranty Warranty
+	warranty.ObjectType = "warranty"
+	warranty.MarbleId = marble_id
+	warranty.Issuer = authed_by_company
+	warranty.IssuedAt = now
+	warranty.ExpiresAt = now + term
+
+	key, err := stub.CreateCompositeKey(warranty.ObjectType, []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	warrantyAsBytes, _ := json.Marshal(warranty)                 //convert to array of bytes
+	err = stub.PutState(key, warrantyAsBytes)                    //replaces an expired one
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end issue_warranty")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// File Warranty Claim - the marble's owner claims against an unexpired warranty
+//
+// Inputs - Array of Strings
+//       0     ,      1       ,         2
+//  marble id  ,  description ,  authing company
+// "m999999999",  "cracked"   , "united marbles"
+//
+// Returns - the claim id
+// ============================================================================================================================
+func file_warranty_claim(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting file_warranty_claim")
+
+	// input sanitation
+	err = sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	description := args[1]
+	authed_by_company := args[2]
+
+	marble, err := get_marble(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if marble.Owner.Company != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot file claims for '" + marble.Owner.Company + "'.")
+	}
+
+	// only the owner's identity (or an admin) can claim for it
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	warranty, err := get_warranty_doc(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now > warranty.ExpiresAt {
+		return shim.Error("Warranty for " + marble_id + " expired at " + strconv.FormatInt(warranty.ExpiresAt, 10))
+	}
+
+	var claim WarrantyClaim
+	claim.ObjectType = "warranty_claim"
+	claim.Id = stub.GetTxID()
+	claim.MarbleId = marble_id
+	claim.OwnerId = marble.Owner.Id
+	claim.Issuer = warranty.Issuer
+	claim.Description = description
+	claim.Status = "open"
+	claim.FiledAt = now
+
+	err = put_warranty_claim(stub, claim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end file_warranty_claim")
+	return shim.Success([]byte(claim.Id))
+}
+
+// ============================================================================================================================
+// Resolve Claim - the warranty issuer approves or rejects an open claim
+//
+// The issuer is the one the claim was filed against, a later warranty doesn't change it. The claimant can't resolve it.
+//
+// Inputs - Array of Strings
+//       0     ,      1     ,     2      ,         3
+//  marble id  ,  claim id  , resolution ,  authing company (the issuer)
+// "m999999999", "2b2d7c...", "approved" , "united marbles"
+// ============================================================================================================================
+func resolve_claim(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	fmt.Println("starting resolve_claim")
+
+	// input sanitation, the claim id is a 64 char tx id
+	err = sanitize_arguments([]string{args[0], args[2], args[3]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	claim_id := args[1]
+	resolution := args[2]
+	authed_by_company := args[3]
+	if resolution != "approved" && resolution != "rejected" {
+		return shim.Error("Resolution must be 'approved' or 'rejected'")
+	}
+
+	key, err := stub.CreateCompositeKey("warranty_claim", []string{marble_id, claim_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claimAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error("Failed to get claim")
+	}
+	var claim WarrantyClaim
+	json.Unmarshal(claimAsBytes, &claim)                         //un stringify it aka JSON.parse()
+	if claim.Id != claim_id {
+		return shim.Error("Claim does not exist - " + claim_id)
+	}
+	if claim.Status != "open" {
+		return shim.Error("Claim is already " + claim.Status)
+	}
+	if claim.Issuer != authed_by_company {
+		return shim.Error("The company '" + authed_by_company + "' cannot resolve claims for warranties issued by '" + claim.Issuer + "'.")
+	}
+	claimant, err := is_owner_identity(stub, claim.OwnerId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if claimant {
+		return shim.Error("The claimant cannot resolve their own claim - " + claim_id)
+	}
+
+	claim.Status = resolution
+	claim.ResolvedAt, err = get_tx_time_ms(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = put_warranty_claim(stub, claim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end resolve_claim")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Warranty - read a marble's warranty and all of its claims
+//
+// Inputs - Array of Strings
+//       0      ,  1 (optional)
+//  marble id   ,    bookmark
+// "m999999999" ,   "9f86d08"
+// ============================================================================================================================
+func get_warranty(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	type WarrantyDetails struct {
+		Warranty Warranty        `json:"warranty"`
+		Claims   []WarrantyClaim `json:"claims"`
+	}
+	var details WarrantyDetails
+
+	marble_id := args[0]
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	warranty, err := get_warranty_doc(stub, marble_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	details.Warranty = warranty
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("warranty_claim", []string{marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(keyParts[1]) {                           //claim id
+			continue
+		}
+		if results.full(keyParts[1]) {
+			break
+		}
+		var claim WarrantyClaim
+		json.Unmarshal(queryResponse.Value, &claim)              //un stringify it aka JSON.parse()
+		details.Claims = append(details.Claims, claim)
+	}
+
+	return results.response(details)
+}
+
+// ============================================================================================================================
+// Warranty helpers
+// ============================================================================================================================
+func get_warranty_doc(stub shim.ChaincodeStubInterface, marble_id string) (Warranty, error) {
+	var warranty Warranty
+	key, err := stub.CreateCompositeKey("warranty", []string{marble_id})
+	if err != nil {
+		return warranty, err
+	}
+	warrantyAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return warranty, errors.New("Failed to get warranty")
+	}
+	json.Unmarshal(warrantyAsBytes, &warranty)                   //un stringify it aka JSON.parse()
+	if warranty.MarbleId != marble_id {                          //test if warranty is actually here or just nil
+		return warranty, errors.New("Marble has no warranty - " + marble_id)
+	}
+	return warranty, nil
+}
+
+func put_warranty_claim(stub shim.ChaincodeStubInterface, claim WarrantyClaim) error {
+	key, err := stub.CreateCompositeKey(claim.ObjectType, []string{claim.MarbleId, claim.Id})
+	if err != nil {
+		return err
+	}
+	claimAsBytes, _ := json.Marshal(claim)                       //convert to array of bytes
+	return stub.PutState(key, claimAsBytes)
+}
@@ -0,0 +1,51 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"testing"
+)
+
+func TestWarrantyCannotBeReplacedOrSelfResolved(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	stub.must(t, alice, "issue_warranty", "m1", YEAR_MS, COMPANY)
+	stub.must_fail(t, alice, "issue_warranty", "m1", YEAR_MS, COMPANY)
+
+	stub.must_fail(t, mallory, "file_warranty_claim", "m1", "cracked", COMPANY)
+	claim_id := string(stub.must(t, alice, "file_warranty_claim", "m1", "cracked", COMPANY).Payload)
+	stub.must_fail(t, alice, "resolve_claim", "m1", claim_id, "approved", COMPANY)
+	stub.must(t, mallory, "resolve_claim", "m1", claim_id, "rejected", COMPANY)
+}
+
+func TestClaimStaysWithItsIssuer(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	carol := new_identity(t, "Org2MSP", "carol")
+	stub.must(t, carol, "init_owner", "o3", "carol", "other marbles")
+	stub.must(t, alice, "issue_warranty", "m1", YEAR_MS, COMPANY)
+	claim_id := string(stub.must(t, alice, "file_warranty_claim", "m1", "cracked", COMPANY).Payload)
+
+	// once it expires the new owner's company can issue one, the old claim is still ours to resolve
+	stub.now += 31536000000 + 1
+	stub.must(t, alice, "set_owner", "m1", "o3", COMPANY)
+	stub.must(t, carol, "issue_warranty", "m1", YEAR_MS, "other marbles")
+	stub.must_fail(t, carol, "resolve_claim", "m1", claim_id, "approved", "other marbles")
+	stub.must(t, mallory, "resolve_claim", "m1", claim_id, "approved", COMPANY)
+}
@@ -0,0 +1,207 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Watchlist Definitions - anyone can watch a marble and gets a "marble_watch" event when it changes
+//
+// Watchers are invoker ids (see whoami). Each watch is stored twice so both directions are a partial key scan,
+// composite keys "watcher" [marble id, invoker id] and "watching" [invoker id, marble id].
+// A write sends one event per marble, tell put_marble_as() the change if it's more than "updated".
+// Fabric keeps one event per transaction, several are batched into one "marble_events" event, see flush_events().
+// ============================================================================================================================
+type WatchEvent struct {
+	MarbleId string   `json:"marbleId"`
+	Change   string   `json:"change"` //updated, transferred or deleted
+	OwnerId  string   `json:"ownerId"`
+	Watchers []string `json:"watchers"`
+	TxId     string   `json:"txId"`
+}
+
+// ============================================================================================================================
+// Watch - start watching a marble
+//
+// Inputs - Array of Strings
+//       0
+//  marble id
+// "m999999999"
+// ============================================================================================================================
+func watch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting watch")
+	return update_watch(stub, args, true)
+}
+
+// ============================================================================================================================
+// Unwatch - stop watching a marble
+//
+// Inputs - Array of Strings
+//       0
+//  marble id
+// "m999999999"
+// ============================================================================================================================
+func unwatch(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	fmt.Println("starting unwatch")
+	return update_watch(stub, args, false)
+}
+
+func update_watch(stub shim.ChaincodeStubInterface, args []string, add bool) pb.Response {
+	// input sanitation
+	err := sanitize_arguments(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	marble_id := args[0]
+	if add {                                                     //let people unwatch marbles that were deleted
+		_, err = get_marble(stub, marble_id)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	invoker, err := get_invoker(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	watcherKey, err := stub.CreateCompositeKey("watcher", []string{marble_id, invoker})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	watchingKey, err := stub.CreateCompositeKey("watching", []string{invoker, marble_id})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, key := range []string{watcherKey, watchingKey} {
+		if add {
+			err = stub.PutState(key, []byte{0x00})               //the key is the index, value just can't be nil
+		} else {
+			err = stub.DelState(key)
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end update_watch")
+	return shim.Success(nil)
+}
+
+// ============================================================================================================================
+// Get Watchlist - read the ids of the marbles someone is watching
+//
+// Inputs - Array of Strings
+//         0        ,  1 (optional)
+//     invoker id   ,    bookmark
+//  "Org1MSP.4f2a...", "m999999999"
+// ============================================================================================================================
+func get_watchlist(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	marble_ids := []string{}
+
+	bookmark := ""
+	if len(args) == 2 {
+		bookmark = args[1]
+	}
+	results, err := new_result_cap(stub, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("watching", []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if results.skip(keyParts[1]) {
+			continue
+		}
+		if results.full(keyParts[1]) {
+			break
+		}
+		marble_ids = append(marble_ids, keyParts[1])
+	}
+
+	return results.response(marble_ids)
+}
+
+// ============================================================================================================================
+// Watchlist helpers
+// ============================================================================================================================
+
+// send a "marble_watch" event if anyone is watching the marble
+func notify_watchers(stub shim.ChaincodeStubInterface, marble Marble, change string) error {
+	watchers, err := get_index_ids(stub, "watcher", marble.Id)
+	if err != nil {
+		return err
+	}
+	if len(watchers) == 0 {
+		return nil
+	}
+
+	var event WatchEvent
+	event.MarbleId = marble.Id
+	event.Change = change
+	event.OwnerId = marble.Owner.Id
+	event.Watchers = watchers
+	event.TxId = stub.GetTxID()
+	eventAsBytes, _ := json.Marshal(event)                       //convert to array of bytes
+	return stub.SetEvent("marble_watch", eventAsBytes)
+}
+
+// the last attribute of every key under an index + first attribute
+func get_index_ids(stub shim.ChaincodeStubInterface, index string, first string) ([]string, error) {
+	ids := []string{}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(index, []string{first})
+	if err != nil {
+		return ids, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return ids, err
+		}
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, attributes[len(attributes) - 1])
+	}
+	return ids, nil
+}
@@ -0,0 +1,49 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransferSendsOneWatchEvent(t *testing.T) {
+	stub, _, alice, mallory := new_identity_fixture(t)
+	stub.must(t, mallory, "watch", "m1")
+
+	stub.must(t, alice, "set_owner", "m1", "o2", COMPANY)
+	if stub.event == nil || stub.event.EventName != BATCH_EVENT_NAME {
+		t.Fatalf("expected a batch of events, got %+v", stub.event)
+	}
+	var events []ChaincodeEvent
+	json.Unmarshal(stub.event.Payload, &events)                 //un stringify it aka JSON.parse()
+	var changes []string
+	for _, event := range events {
+		if event.Name == "marble_watch" {
+			var watch WatchEvent
+			json.Unmarshal(event.Payload, &watch)
+			changes = append(changes, watch.Change)
+		}
+	}
+	if len(changes) != 1 || changes[0] != "transferred" {
+		t.Fatalf("watchers should hear one transferred event, got %v", changes)
+	}
+}
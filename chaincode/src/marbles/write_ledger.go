@@ -30,7 +30,25 @@ import (
 )
 
 // ============================================================================================================================
-// write() - genric write variable into ledger
+// Protected Keys - keys write() will never touch, even for an admin. Every "_" key and composite key is protected too
+// ============================================================================================================================
+var protected_keys = []string{
+	ADMINS_KEY, PAUSED_KEY, ROLES_KEY, LIFECYCLE_KEY, INSPECTION_POLICY_KEY, VELOCITY_RULES_KEY,
+	RARITY_CAPS_KEY, POOL_COOLDOWN_KEY, ALLOWED_UNITS_KEY, SIZE_BOUNDS_KEY, INVITES_REQUIRED_KEY,
+	DAILY_LIMIT_KEY, MAX_RESULTS_KEY, "marbles_ui",
+}
+
+func is_protected_key(key string) bool {
+	if strings.HasPrefix(key, "_") || strings.HasPrefix(key, "\x00") { //system keys, composite keys start with a null
+		return true
+	}
+	return contains(protected_keys, key)
+}
+
+const MAX_BULK_OWNERS = 500
+
+// ============================================================================================================================
+// write() - genric write variable into ledger. Admin only
 // 
 // Shows Off PutState() - writting a key/value into the ledger
 //
@@ -44,10 +62,6 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting write")
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2. key of the variable and value to set")
-	}
-
 	// input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
@@ -56,6 +70,15 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	key = args[0]                                   //rename for funsies
 	value = args[1]
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if is_protected_key(key) {
+		return shim.Error("Key '" + key + "' is protected, use the function that manages it")
+	}
+
 	err = stub.PutState(key, []byte(value))         //write the variable into the ledger
 	if err != nil {
 		return shim.Error(err.Error())
@@ -78,10 +101,6 @@ func write(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 func delete_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 	fmt.Println("starting delete_marble")
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
-	}
-
 	// input sanitation
 	err := sanitize_arguments(args)
 	if err != nil {
@@ -103,10 +122,26 @@ func delete_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response
 		return shim.Error("The company '" + authed_by_company + "' cannot authorize deletion for '" + marble.Owner.Company + "'.")
 	}
 
+	// only the owner's identity (or an admin) can delete it
+	err = check_owner_identity(stub, marble.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// protected marbles need two steps
+	if marble.Protected {
+		return shim.Error("Marble is protected, use request_delete and have an admin approve it - " + id)
+	}
+
+	// co-owned marbles aren't the owner's alone to delete
+	if len(marble.Shares) > 0 {
+		return shim.Error("Marble is co-owned, share holders must approve a transfer to one owner first - " + id)
+	}
+
 	// remove the marble
-	err = stub.DelState(id)                                                 //remove the key from chaincode state
+	err = remove_marble(stub, marble)
 	if err != nil {
-		return shim.Error("Failed to delete state")
+		return shim.Error(err.Error())
 	}
 
 	fmt.Println("- end delete_marble")
@@ -116,21 +151,19 @@ func delete_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response
 // ============================================================================================================================
 // Init Marble - create a new marble, store into chaincode state
 //
-// Shows off building a key's JSON value manually
+// Shows off building key's value from GoLang Structure
 //
 // Inputs - Array of strings
-//      0      ,    1  ,  2  ,      3          ,       4
-//     id      ,  color, size,     owner id    ,  authing company
-// "m999999999", "blue", "35", "o9999999999999", "united marbles"
+//      0      ,    1  ,  2  ,      3          ,       4          ,     5 (optional) ,  6...11 (optional)
+//     id      ,  color, size,     owner id    ,  authing company ,  rarity          ,  physical data, as set_physical() takes it
+// "m999999999", "blue", "35", "o9999999999999", "united marbles" ,  "rare"          ,  "5.2", "g", "16", "16", "16", "mm"
+//
+// Physical data at mint means the marble's fingerprint is checked before it exists, see fingerprint.go.
 // ============================================================================================================================
 func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response) {
 	var err error
 	fmt.Println("starting init_marble")
 
-	if len(args) != 5 {
-		return shim.Error("Incorrect number of arguments. Expecting 5")
-	}
-
 	//input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
@@ -138,13 +171,28 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 	}
 
 	id := args[0]
-	color := strings.ToLower(args[1])
+	color := normalize_name(args[1])
 	owner_id := args[3]
 	authed_by_company := args[4]
 	size, err := strconv.Atoi(args[2])
 	if err != nil {
 		return shim.Error("3rd argument must be a numeric string")
 	}
+	rarity := "common"
+	if len(args) >= 6 {
+		rarity = normalize_name(args[5])
+	}
+	var physical *Physical
+	if len(args) > 6 && len(args) != 12 {
+		return shim.Error("Physical data needs all 6 values, as set_physical() takes them")
+	}
+	if len(args) == 12 {
+		parsed, err := parse_physical(stub, args[6:])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		physical = &parsed
+	}
 
 	//check if new owner exists
 	owner, err := get_owner(stub, owner_id)
@@ -158,33 +206,24 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 		return shim.Error("The company '" + authed_by_company + "' cannot authorize creation for '" + owner.Company + "'.")
 	}
 
-	//check if marble id already exists
-	marble, err := get_marble(stub, id)
-	if err == nil {
-		fmt.Println("This marble already exists - " + id)
-		fmt.Println(marble)
-		return shim.Error("This marble already exists - " + id)  //all stop a marble by this id exists
-	}
-
-	//build the marble json string manually
-	str := `{
-		"docType":"marble", 
-		"id": "` + id + `", 
-		"color": "` + color + `", 
-		"size": ` + strconv.Itoa(size) + `, 
-		"owner": {
-			"id": "` + owner_id + `", 
-			"username": "` + owner.Username + `", 
-			"company": "` + owner.Company + `"
-		}
-	}`
-	err = stub.PutState(id, []byte(str))                         //store marble with id as key
+	//build the marble, create_marble() takes care of rarity caps, lifecycle, etc.
+	var marble Marble
+	marble.Id = id
+	marble.Color = color
+	marble.Size = size
+	marble.Rarity = rarity
+	marble.Owner.Id = owner.Id
+	marble.Owner.Username = owner.Username
+	marble.Owner.Company = owner.Company
+	marble.Physical = physical
+	err = create_marble(stub, &marble)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	fmt.Println("- end init_marble")
-	return shim.Success(nil)
+	marbleAsBytes, _ := json.Marshal(marble)      //send back the marble as stored, saves the client a query
+	return shim.Success(marbleAsBytes)
 }
 
 // ============================================================================================================================
@@ -193,18 +232,14 @@ func init_marble(stub shim.ChaincodeStubInterface, args []string) (pb.Response)
 // Shows off building key's value from GoLang Structure
 //
 // Inputs - Array of Strings
-//           0     ,     1   ,   2
-//      owner id   , username, company
-// "o9999999999999",     bob", "united marbles"
+//           0     ,     1   ,   2            ,      3 (optional)
+//      owner id   , username, company        , invitation code (required if invites are on, see invites.go)
+// "o9999999999999",     bob", "united marbles", "x7Kq2mPz"
 // ============================================================================================================================
 func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
 	fmt.Println("starting init_owner")
 
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
-	}
-
 	//input sanitation
 	err = sanitize_arguments(args)
 	if err != nil {
@@ -214,9 +249,20 @@ func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var owner Owner
 	owner.ObjectType = "marble_owner"
 	owner.Id =  args[0]
-	owner.Username = strings.ToLower(args[1])
+	owner.Username = normalize_name(args[1])
 	owner.Company = args[2]
+	err = check_owner_id_allowed(owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner.Identity, err = get_identity_fingerprint(stub)           //whoever creates the owner controls it
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	fmt.Println(owner)
+	if len(owner.Username) == 0 {
+		return shim.Error("Username must have something other than spaces")
+	}
 
 	//check if user already exists
 	_, err = get_owner(stub, owner.Id)
@@ -225,6 +271,22 @@ func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		return shim.Error("This owner already exists - " + owner.Id)
 	}
 
+	//check nobody at this company has the username already, "Bob" and "bob " are the same user
+	err = index_username(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//use up the invitation, if this deployment needs them
+	code := ""
+	if len(args) == 4 {
+		code = args[3]
+	}
+	err = consume_invite(stub, code, owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	//store user
 	ownerAsBytes, _ := json.Marshal(owner)                         //convert to array of bytes
 	err = stub.PutState(owner.Id, ownerAsBytes)                    //store owner by its Id
@@ -237,6 +299,87 @@ func init_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	return shim.Success(nil)
 }
 
+// ============================================================================================================================
+// Init Owners Bulk - create a whole list of owners in one transaction. Admin only, so no invitation codes needed
+//
+// Every owner is checked like init_owner() does before any are stored, one bad owner fails the lot.
+//
+// Inputs - Array of Strings
+//                                       0
+//                                  owners json
+// "[{"id":"o9999999999999","username":"bob","company":"united marbles"}, ...]"
+// ============================================================================================================================
+func init_owners_bulk(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var owners []Owner
+	var err error
+	fmt.Println("starting init_owners_bulk")
+
+	err = check_admin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = json.Unmarshal([]byte(args[0]), &owners)     //un stringify it aka JSON.parse()
+	if err != nil {
+		return shim.Error("Owners must be a json array of {id, username, company}")
+	}
+	if len(owners) == 0 || len(owners) > MAX_BULK_OWNERS {
+		return shim.Error("Expecting 1 to " + strconv.Itoa(MAX_BULK_OWNERS) + " owners")
+	}
+
+	// check them all first, the ledger won't show us owners from earlier in this same tx so track those here
+	ids := map[string]bool{}
+	usernames := map[string]bool{}
+	for i := range owners {
+		owner := &owners[i]
+		err = sanitize_arguments([]string{owner.Id, owner.Username, owner.Company})
+		if err != nil {
+			return shim.Error("Owner " + strconv.Itoa(i) + " - " + err.Error())
+		}
+		err = check_owner_id_allowed(owner.Id)
+		if err != nil {
+			return shim.Error("Owner " + strconv.Itoa(i) + " - " + err.Error())
+		}
+		owner.ObjectType = "marble_owner"
+		owner.Username = normalize_name(owner.Username)
+		owner.PublicKey = ""                           //only the owner can register one, see register_public_key()
+		owner.Flagged = false
+		owner.FlaggedAt = 0
+		owner.Desk = false                             //desks come from create_desk()
+		owner.Identity = ""                            //an admin binds one later, see set_owner_identity()
+		if len(owner.Username) == 0 {
+			return shim.Error("Owner " + strconv.Itoa(i) + " - username must have something other than spaces")
+		}
+
+		username_key := owner.Company + "/" + owner.Username
+		if ids[owner.Id] || usernames[username_key] {
+			return shim.Error("Owner " + strconv.Itoa(i) + " is in the list twice - " + owner.Id + ", '" + owner.Username + "'")
+		}
+		ids[owner.Id] = true
+		usernames[username_key] = true
+
+		_, err = get_owner(stub, owner.Id)
+		if err == nil {
+			return shim.Error("This owner already exists - " + owner.Id)
+		}
+	}
+
+	// then store them and their usernames in one pass
+	for _, owner := range owners {
+		err = index_username(stub, owner)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = put_owner(stub, owner)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	fmt.Println("- end init_owners_bulk, created " + strconv.Itoa(len(owners)))
+	return shim.Success(nil)
+}
+
 // ============================================================================================================================
 // Set Owner on Marble
 //
@@ -255,10 +398,7 @@ func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	// todo - get the "company that authed the transfer" from the certificate instead of an argument
 	// should be possible since we can now add attributes to the enrollment cert
 	// as is.. this is a bit broken (security wise), but it's much much easier to demo! holding off for demos sake
-
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
-	}
+	// the caller does have to be the current owner's identity (or an admin) though, see identity.go
 
 	// input sanitation
 	err = sanitize_arguments(args)
@@ -290,16 +430,19 @@ func set_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		return shim.Error("The company '" + authed_by_company + "' cannot authorize transfers for '" + res.Owner.Company + "'.")
 	}
 
+	// only the owner's identity (or an admin) can give it away
+	err = check_owner_identity(stub, res.Owner.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// transfer the marble
-	res.Owner.Id = new_owner_id                   //change the owner
-	res.Owner.Username = owner.Username
-	res.Owner.Company = owner.Company
-	jsonAsBytes, _ := json.Marshal(res)           //convert to array of bytes
-	err = stub.PutState(args[0], jsonAsBytes)     //rewrite the marble with id as key
+	err = transfer_marble(stub, &res, owner)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	fmt.Println("- end set owner")
-	return shim.Success(nil)
+	resAsBytes, _ := json.Marshal(res)            //send back the marble as stored, saves the client a query
+	return shim.Success(resAsBytes)
 }
@@ -0,0 +1,106 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestBulkOwnersCannotSetPrivilegedFields(t *testing.T) {
+	stub, admin, _, mallory := new_identity_fixture(t)
+	mallory_identity := string(stub.must(t, mallory, "get_identity").Payload)
+
+	stub.must(t, admin, "init_owners_bulk", `[{"id":"o3","username":"carol","company":"`+COMPANY+`","desk":true,"identity":"`+mallory_identity+`","publicKey":"x","flagged":true}]`)
+	var owner Owner
+	json.Unmarshal(stub.State["o3"], &owner)                     //un stringify it aka JSON.parse()
+	if owner.Desk || len(owner.Identity) > 0 || len(owner.PublicKey) > 0 || owner.Flagged {
+		t.Fatalf("bulk owner kept a field it can't set - %+v", owner)
+	}
+}
+
+// ============================================================================================================================
+// Benchmarks - the hot paths at 1k/10k/100k marbles already on the ledger
+//
+// Commits are bulk (see test_stub) since MockStub's sorted key list costs O(n) a write, and every scan walks it from the
+// front, which would swamp the chaincode's own cost. There is no perform_trade or cleanTrades in this chaincode, set_owner is the trade and delete_marble the
+// clean up. Run with go test -run x -bench . -benchtime 1000x, seeding 100k takes a while.
+// ============================================================================================================================
+var bench_sizes = []int{1000, 10000, 100000}
+
+// a ledger with n marbles split between o1 and o2
+func new_bench_stub(b *testing.B, n int) (*test_stub, []byte, []byte) {
+	stub, admin := new_test_stub(b)
+	alice := new_identity(b, "Org1MSP", "alice")
+	bob := new_identity(b, "Org1MSP", "bob")
+	stub.must(b, alice, "init_owner", "o1", "alice", COMPANY)
+	stub.must(b, bob, "init_owner", "o2", "bob", COMPANY)
+	stub.bulk = true
+	for i := 0; i < n; i++ {
+		stub.must(b, admin, "init_marble", "m" + strconv.Itoa(i), "blue", "35", "o" + strconv.Itoa(1 + i % 2), COMPANY)
+	}
+	stub.sort_keys()
+	return stub, admin, alice
+}
+
+func BenchmarkInitMarble(b *testing.B) {
+	for _, n := range bench_sizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub, _, alice := new_bench_stub(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stub.must(b, alice, "init_marble", "mnew" + strconv.Itoa(i), "blue", "35", "o1", COMPANY)
+			}
+		})
+	}
+}
+
+func BenchmarkSetOwner(b *testing.B) {
+	for _, n := range bench_sizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub, admin, _ := new_bench_stub(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				round := i / n                                   //every marble moves once a round, back and forth
+				stub.must(b, admin, "set_owner", "m" + strconv.Itoa(i % n), "o" + strconv.Itoa(1 + (i + round + 1) % 2), COMPANY)
+			}
+		})
+	}
+}
+
+func BenchmarkDeleteMarble(b *testing.B) {
+	for _, n := range bench_sizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			stub, admin, _ := new_bench_stub(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := "m" + strconv.Itoa(i % n)
+				if i >= n {                                      //put it back for the next round
+					b.StopTimer()
+					stub.must(b, admin, "init_marble", id, "blue", "35", "o1", COMPANY)
+					b.StartTimer()
+				}
+				stub.must(b, admin, "delete_marble", id, COMPANY)
+			}
+		})
+	}
+}